@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// adminLimiter limits the forced refreshes of each repository to one per the
+// ADMIN_REFRESH_COOLDOWN seconds, so the admin API cannot burn the quota of
+// the GitHub API.
+type adminLimiter struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// newAdminLimiter creates a new empty adminLimiter.
+func newAdminLimiter() *adminLimiter {
+	return &adminLimiter{last: make(map[string]time.Time)}
+}
+
+// allow checks, if the repository with the given key can be refreshed now
+// with the given cooldown, and remembers the time of the refresh. Otherwise,
+// it returns the time to wait before the next refresh.
+func (l *adminLimiter) allow(key string, cooldown time.Duration) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Check the time since the last forced refresh of the repository.
+	if last, ok := l.last[key]; ok && time.Since(last) < cooldown {
+		return cooldown - time.Since(last), false
+	}
+	l.last[key] = time.Now()
+
+	return 0, true
+}
+
+// adminRefreshResult is a struct that represents the outcome of the forced
+// refresh of the repository: "success", "failure" (with the error) or
+// "rate_limited" (with the seconds to wait before the next refresh).
+type adminRefreshResult struct {
+	Repository string     `json:"repository"`
+	Images     []string   `json:"images"`
+	Outcome    string     `json:"outcome"`
+	Error      string     `json:"error,omitempty"`
+	RetryAfter int        `json:"retry_after,omitempty"`
+	DurationMs int64      `json:"duration_ms"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+}
+
+// adminRefreshResponse is a struct that represents the response of the admin
+// API with the outcomes of the forced refreshes.
+type adminRefreshResponse struct {
+	Results []adminRefreshResult `json:"results"`
+}
+
+// handleAdminRefresh returns an HTTP handler, which forces the immediate
+// refresh of the requested repository (or all repositories in the registry, if
+// the owner and name are not in the path), and serves the outcome of each
+// refresh in the JSON format.
+//
+// The request must have the "Authorization: Bearer <ADMIN_TOKEN>" header. The
+// "image" query parameter limits the refresh to the source of the one image
+// (e.g., "?image=stargazers"). Each repository is refreshed once per the
+// ADMIN_REFRESH_COOLDOWN seconds at most.
+func (c *Config) handleAdminRefresh(reg *Registry, limiter *adminLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+		// Check, if the admin API is enabled, and the bearer token of the request.
+		if c.Admin.Token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.Admin.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+
+		// Select the requested repository, or all repositories in the registry.
+		targets := reg.list()
+		if owner := r.PathValue("owner"); owner != "" {
+			stats, ok := reg.lookup(owner, r.PathValue("repo"))
+			if !ok {
+				http.Error(w, fmt.Sprintf("repository '%s/%s' is not served", owner, r.PathValue("repo")), http.StatusNotFound)
+				return
+			}
+			targets = []*Stats{stats}
+		}
+
+		// The refresh may take longer than the write timeout of the server, so the deadline is removed.
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil &&
+			!errors.Is(err, http.ErrNotSupported) {
+			slog.Warn("failed to remove write deadline of admin request", "details", err.Error())
+		}
+
+		// Refresh the selected repositories one by one.
+		response := adminRefreshResponse{Results: make([]adminRefreshResult, 0, len(targets))}
+		status := http.StatusOK
+		for _, stats := range targets {
+			// Select the requested image of the repository, or all of its images.
+			repo := stats.repository()
+			images := repo.Images
+			if name := r.URL.Query().Get("image"); name != "" {
+				def := repo.image(name)
+				if def == nil {
+					continue
+				}
+				images = []*imageDefinition{def}
+			}
+
+			result := c.adminRefresh(stats, images, limiter)
+			response.Results = append(response.Results, result)
+
+			// Set the status by the worst outcome: the failure, then the rate limit.
+			switch {
+			case result.Outcome == "failure":
+				status = http.StatusBadGateway
+			case result.Outcome == "rate_limited" && status == http.StatusOK:
+				status = http.StatusTooManyRequests
+				w.Header().Set("Retry-After", strconv.Itoa(result.RetryAfter))
+			}
+		}
+
+		// Serve the 404 status, if no repository has the requested image.
+		if len(response.Results) == 0 {
+			http.Error(w, fmt.Sprintf("unknown image '%s'", r.URL.Query().Get("image")), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w).Encode(response); err != nil {
+			slog.Error("encode to application/json", "details", err.Error())
+			return
+		}
+	}
+}
+
+// adminRefresh forces the refresh of the given images of the repository of the
+// given stats, if it is allowed by the given limiter, and returns its outcome.
+func (c *Config) adminRefresh(stats *Stats, images []*imageDefinition, limiter *adminLimiter) adminRefreshResult {
+	// Create a new result with the names of the images.
+	repo := stats.repository()
+	result := adminRefreshResult{Repository: repo.String(), Images: make([]string, 0, len(images))}
+	for _, def := range images {
+		result.Images = append(result.Images, def.Name)
+	}
+
+	// Skip the refresh, if the repository was refreshed recently.
+	wait, ok := limiter.allow(registryKey(repo.Owner, repo.Name), time.Duration(c.Admin.RefreshCooldown)*time.Second)
+	if !ok {
+		result.Outcome, result.RetryAfter = "rate_limited", int(wait.Seconds())+1
+		result.UpdatedAt = makeStatusTime(stats.lastUpdate())
+		return result
+	}
+
+	// Fetch the avatar images and prepare the final images.
+	start := time.Now()
+	err := c.updateStatsImages(stats, images)
+	result.DurationMs = time.Since(start).Milliseconds()
+	result.UpdatedAt = makeStatusTime(stats.lastUpdate())
+	if err != nil {
+		slog.Error("failed to force refresh", "repository", repo.String(), "images", result.Images, "details", err.Error())
+		result.Outcome, result.Error = "failure", err.Error()
+		return result
+	}
+
+	slog.Info("successfully forced refresh", "repository", repo.String(), "images", result.Images)
+	result.Outcome = "success"
+
+	return result
+}
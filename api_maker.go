@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// apiUser is a struct that represents the user in the JSON API response.
+type apiUser struct {
+	Login         string     `json:"login"`
+	AvatarURL     string     `json:"avatar_url"`
+	ProfileURL    string     `json:"profile_url"`
+	Contributions int        `json:"contributions,omitempty"`
+	StarredAt     *time.Time `json:"starred_at,omitempty"`
+	Rendered      bool       `json:"rendered"`
+}
+
+// apiMeta is a struct that represents the metadata of the JSON API response.
+type apiMeta struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	Total     int       `json:"total"`
+	Rendered  int       `json:"rendered"`
+	Page      int       `json:"page"`
+	PerPage   int       `json:"per_page"`
+	Pages     int       `json:"pages"`
+}
+
+// apiResponse is a struct that represents the JSON API response with the users
+// behind the final image.
+type apiResponse struct {
+	Meta  apiMeta   `json:"meta"`
+	Users []apiUser `json:"users"`
+}
+
+// makeAPIResponse makes a JSON API response with the given users (in the same
+// order as they are rendered on the final image with the given render options)
+// for the given page.
+func makeAPIResponse(avatars []UserAvatar, updatedAt time.Time, page, perPage int, o renderOptions) apiResponse {
+	// Collect the users, which are shown on the final image.
+	visible := prepareVisibleAvatars(avatars, o)
+	rendered := make(map[string]bool, len(visible))
+	for _, avatar := range visible {
+		rendered[avatar.Login] = true
+	}
+
+	// Calculate the bounds of the given page.
+	start, end := makeAPIPageBounds(len(avatars), page, perPage)
+
+	// Create a slice of apiUser structs for the given page.
+	users := make([]apiUser, 0, end-start)
+	for _, avatar := range avatars[start:end] {
+		// Create a new user for the response.
+		user := apiUser{
+			Login:         avatar.Login,
+			AvatarURL:     avatar.URL,
+			ProfileURL:    avatar.ProfileURL,
+			Contributions: avatar.Contributions,
+			Rendered:      rendered[avatar.Login],
+		}
+
+		// Set the time of starring, if it exists.
+		if !avatar.StarredAt.IsZero() {
+			starredAt := avatar.StarredAt
+			user.StarredAt = &starredAt
+		}
+
+		users = append(users, user)
+	}
+
+	return apiResponse{
+		Meta: apiMeta{
+			UpdatedAt: updatedAt,
+			Total:     len(avatars),
+			Rendered:  len(visible),
+			Page:      page,
+			PerPage:   perPage,
+			Pages:     (len(avatars) + perPage - 1) / perPage,
+		},
+		Users: users,
+	}
+}
+
+// makeAPIPageBounds returns the bounds of the given page of the given number
+// of the items. The pages after the last one are empty (the bounds are checked
+// before the multiplication, so a huge page cannot overflow them).
+func makeAPIPageBounds(total, page, perPage int) (start, end int) {
+	if page-1 >= (total+perPage-1)/perPage {
+		return total, total
+	}
+	start = (page - 1) * perPage
+
+	return start, min(start+perPage, total)
+}
+
+// lostAPIMeta is a struct that represents the metadata of the JSON API
+// response with the lost stargazers: the total number of the known unstars,
+// and the churn (the number of the unstars within the time range).
+type lostAPIMeta struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	Total     int       `json:"total"`
+	Churn     int       `json:"churn"`
+	Range     string    `json:"range"`
+	Page      int       `json:"page"`
+	PerPage   int       `json:"per_page"`
+	Pages     int       `json:"pages"`
+}
+
+// lostAPIResponse is a struct that represents the JSON API response with the
+// lost stargazers of the repository.
+type lostAPIResponse struct {
+	Meta  lostAPIMeta     `json:"meta"`
+	Users []lostStargazer `json:"users"`
+}
+
+// makeLostAPIResponse makes a JSON API response with the given lost stargazers
+// (from the newest unstar to the oldest one) for the given page, with the
+// churn within the given time range (e.g., "30d" or "all") up to the given
+// time of the update.
+func makeLostAPIResponse(
+	lost []lostStargazer, updatedAt time.Time, page, perPage int, churnRange string,
+) (lostAPIResponse, error) {
+	// Parse the time range of the churn.
+	duration, err := helpParseRange(churnRange)
+	if err != nil {
+		return lostAPIResponse{}, err
+	}
+
+	// Count the unstars within the time range.
+	churn := 0
+	for _, user := range lost {
+		if duration == 0 || !user.UnstarredAt.Before(updatedAt.Add(-duration)) {
+			churn++
+		}
+	}
+
+	// Order the lost stargazers from the newest unstar.
+	lost = slices.Clone(lost)
+	slices.Reverse(lost)
+
+	// Calculate the bounds of the given page.
+	start, end := makeAPIPageBounds(len(lost), page, perPage)
+
+	return lostAPIResponse{
+		Meta: lostAPIMeta{
+			UpdatedAt: updatedAt,
+			Total:     len(lost),
+			Churn:     churn,
+			Range:     churnRange,
+			Page:      page,
+			PerPage:   perPage,
+			Pages:     (len(lost) + perPage - 1) / perPage,
+		},
+		Users: lost[start:end],
+	}, nil
+}
+
+// makeAPIPagination parses the pagination parameters ("page" and "per_page")
+// from the given values. It returns an error, if the parameters are not valid.
+func makeAPIPagination(pageValue, perPageValue string) (page, perPage int, err error) {
+	// Set the default pagination parameters.
+	page, perPage = 1, 30
+
+	// Parse the page parameter, if it exists.
+	if pageValue != "" {
+		page, err = strconv.Atoi(pageValue)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("wrong page parameter '%s' (must be an integer >= 1)", pageValue)
+		}
+	}
+
+	// Parse the per_page parameter, if it exists.
+	if perPageValue != "" {
+		perPage, err = strconv.Atoi(perPageValue)
+		if err != nil || perPage < 1 || perPage > 100 {
+			return 0, 0, fmt.Errorf("wrong per_page parameter '%s' (must be an integer from 1 to 100)", perPageValue)
+		}
+	}
+
+	return page, perPage, nil
+}
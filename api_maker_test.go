@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMakeAPIPagination(t *testing.T) {
+	tests := []struct {
+		name              string
+		page, perPage     string
+		wantPage, wantPer int
+		wantErr           bool
+	}{
+		{"defaults", "", "", 1, 30, false},
+		{"both set", "3", "50", 3, 50, false},
+		{"max per page", "1", "100", 1, 100, false},
+		{"zero page", "0", "", 0, 0, true},
+		{"negative page", "-1", "", 0, 0, true},
+		{"not a number page", "abc", "", 0, 0, true},
+		{"zero per page", "", "0", 0, 0, true},
+		{"too many per page", "", "101", 0, 0, true},
+		{"not a number per page", "", "1.5", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, perPage, err := makeAPIPagination(tt.page, tt.perPage)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("makeAPIPagination(%q, %q) error = %v, want error %v", tt.page, tt.perPage, err, tt.wantErr)
+			}
+			if page != tt.wantPage || perPage != tt.wantPer {
+				t.Errorf(
+					"makeAPIPagination(%q, %q) = %d, %d, want %d, %d",
+					tt.page, tt.perPage, page, perPage, tt.wantPage, tt.wantPer,
+				)
+			}
+		})
+	}
+}
+
+func TestMakeAPIPageBounds(t *testing.T) {
+	tests := []struct {
+		name                 string
+		total, page, perPage int
+		wantStart, wantEnd   int
+	}{
+		{"first page", 95, 1, 30, 0, 30},
+		{"last partial page", 95, 4, 30, 90, 95},
+		{"past the last page", 95, 5, 30, 95, 95},
+		{"empty list", 0, 1, 30, 0, 0},
+		{"overflowing page", 95, math.MaxInt, 100, 95, 95},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := makeAPIPageBounds(tt.total, tt.page, tt.perPage)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf(
+					"makeAPIPageBounds(%d, %d, %d) = %d, %d, want %d, %d",
+					tt.total, tt.page, tt.perPage, start, end, tt.wantStart, tt.wantEnd,
+				)
+			}
+		})
+	}
+}
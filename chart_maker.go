@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+// The size of the star history chart and the margins of its plot area (in
+// pixels).
+const (
+	chartWidth, chartHeight                   = 800, 400
+	chartMarginLeft, chartMarginRight         = 64, 24
+	chartMarginTop, chartMarginBottom         = 56, 40
+	chartFontSize, chartTitleSize     float64 = 12, 16
+)
+
+// chartFontFamily is the font family of the text of the chart in the SVG format
+// (the system fonts, as on GitHub).
+const chartFontFamily = "-apple-system, BlinkMacSystemFont, 'Segoe UI', Helvetica, Arial, sans-serif"
+
+// chartTheme represents the colors of the star history chart.
+type chartTheme struct {
+	Background, Text, Grid, Line color.NRGBA
+}
+
+// chartThemes is a map of the themes of the star history chart by their names
+// (the colors follow the light and dark themes of GitHub).
+var chartThemes = map[string]chartTheme{
+	"light": {
+		Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		Text:       color.NRGBA{R: 0x24, G: 0x29, B: 0x2f, A: 0xff},
+		Grid:       color.NRGBA{R: 0xd0, G: 0xd7, B: 0xde, A: 0xff},
+		Line:       color.NRGBA{R: 0xbf, G: 0x87, B: 0x00, A: 0xff},
+	},
+	"dark": {
+		Background: color.NRGBA{R: 0x0d, G: 0x11, B: 0x17, A: 0xff},
+		Text:       color.NRGBA{R: 0xc9, G: 0xd1, B: 0xd9, A: 0xff},
+		Grid:       color.NRGBA{R: 0x30, G: 0x36, B: 0x3d, A: 0xff},
+		Line:       color.NRGBA{R: 0xe3, G: 0xb3, B: 0x41, A: 0xff},
+	},
+}
+
+// chartOptions represents the options to draw the star history chart: the
+// theme, the time range (0 for the whole history) and the colors of the line
+// and the background (the zero color for the one of the theme).
+type chartOptions struct {
+	Theme                      string
+	Range                      time.Duration
+	LineColor, BackgroundColor color.NRGBA
+}
+
+// defaultChartOptions returns the options to draw the star history chart from
+// the star history configuration of the application.
+func (c *Config) defaultChartOptions() chartOptions {
+	return chartOptions{
+		Theme:           c.StarHistory.Theme,
+		Range:           c.StarHistory.Range,
+		LineColor:       c.StarHistory.LineColor,
+		BackgroundColor: c.StarHistory.BackgroundColor,
+	}
+}
+
+// prepareChartOptions returns the chart options with the values from the given
+// query parameters ("theme", "range", "line_color" and "background_color")
+// over the given base ones. It returns an error, if any value is not valid.
+func prepareChartOptions(o chartOptions, query url.Values) (chartOptions, error) {
+	// Set the theme, if it exists.
+	if theme := query.Get("theme"); theme != "" {
+		if _, ok := chartThemes[theme]; !ok {
+			return chartOptions{}, fmt.Errorf("wrong theme '%s' (must be one of: light, dark)", theme)
+		}
+		o.Theme = theme
+	}
+
+	// Set the time range, if it exists.
+	if value := query.Get("range"); value != "" {
+		parsed, err := helpParseRange(value)
+		if err != nil {
+			return chartOptions{}, err
+		}
+		o.Range = parsed
+	}
+
+	// Set the colors, if they exist.
+	colors := map[string]*color.NRGBA{"line_color": &o.LineColor, "background_color": &o.BackgroundColor}
+	for name, target := range colors {
+		if value := query.Get(name); value != "" {
+			parsed, err := helpParseHexColor(value)
+			if err != nil {
+				return chartOptions{}, err
+			}
+			*target = parsed
+		}
+	}
+
+	return o, nil
+}
+
+// theme returns the colors of the theme of the options with the custom colors
+// of the line and the background over them.
+func (o chartOptions) theme() chartTheme {
+	theme := chartThemes[o.Theme]
+	if o.LineColor.A != 0 {
+		theme.Line = o.LineColor
+	}
+	if o.BackgroundColor.A != 0 {
+		theme.Background = o.BackgroundColor
+	}
+
+	return theme
+}
+
+// chartTick represents the tick of the axis of the chart: its position (in
+// pixels) and its label.
+type chartTick struct {
+	Pos   float64
+	Label string
+}
+
+// chartLayout represents the star history chart, which is laid out to be drawn
+// in any format: the title with the total number of the stars, the line (in
+// pixels) with the indexes of its points, which are reached by the unknown
+// range (drawn dashed), and the ticks of both axes.
+type chartLayout struct {
+	Title, Total   string
+	Line           [][2]float64
+	Gaps           []int
+	XTicks, YTicks []chartTick
+}
+
+// runs returns the parts of the line of the layout, which are split by the
+// unknown ranges (each part has one point at least).
+func (l chartLayout) runs() [][][2]float64 {
+	runs := make([][][2]float64, 0, len(l.Gaps)+1)
+	start := 0
+	for _, gap := range l.Gaps {
+		runs = append(runs, l.Line[start:gap])
+		start = gap
+	}
+
+	return append(runs, l.Line[start:])
+}
+
+// makeChartLayout lays out the star history chart with the given title from
+// the given points of the star history.
+func makeChartLayout(title string, points []starSample) chartLayout {
+	layout := chartLayout{Title: title, Total: "no stars yet"}
+	if len(points) == 0 {
+		return layout
+	}
+
+	// Set the bounds of the plot area, and the ranges of the axes.
+	left, right := float64(chartMarginLeft), float64(chartWidth-chartMarginRight)
+	top, bottom := float64(chartMarginTop), float64(chartHeight-chartMarginBottom)
+	from, to := points[0].At, points[len(points)-1].At
+	if !to.After(from) {
+		from = to.Add(-time.Hour)
+	}
+	maxCount := 0
+	for _, point := range points {
+		maxCount = max(maxCount, point.Count)
+	}
+	step := chartStep(float64(max(maxCount, 1)) / 4)
+	maxY := step * math.Ceil(float64(max(maxCount, 1))/step)
+
+	// Set the total number of the stars.
+	total := points[len(points)-1].Count
+	layout.Total = fmt.Sprintf("%s stars", formatChartNumber(total))
+	if total == 1 {
+		layout.Total = "1 star"
+	}
+
+	// Convert the points to the pixels of the plot area.
+	span := to.Sub(from).Seconds()
+	for index, point := range points {
+		x := left + (right-left)*point.At.Sub(from).Seconds()/span
+		y := bottom - (bottom-top)*float64(point.Count)/maxY
+		layout.Line = append(layout.Line, [2]float64{x, y})
+		if point.Gap && index > 0 {
+			layout.Gaps = append(layout.Gaps, index)
+		}
+	}
+
+	// Add the ticks of the Y axis from zero to the max number by the step.
+	for value := 0.0; value <= maxY; value += step {
+		layout.YTicks = append(layout.YTicks, chartTick{
+			Pos: bottom - (bottom-top)*value/maxY, Label: formatChartCount(int(value)),
+		})
+	}
+
+	// Add five ticks of the X axis with the dates in the format by the span of the range.
+	format := "Jan 2 15:04"
+	switch duration := to.Sub(from); {
+	case duration >= 2*365*24*time.Hour:
+		format = "2006"
+	case duration >= 60*24*time.Hour:
+		format = "Jan 2006"
+	case duration >= 2*24*time.Hour:
+		format = "Jan 2"
+	}
+	for index := 0; index < 5; index++ {
+		at := from.Add(time.Duration(float64(to.Sub(from)) * float64(index) / 4))
+		layout.XTicks = append(layout.XTicks, chartTick{
+			Pos: left + (right-left)*float64(index)/4, Label: at.UTC().Format(format),
+		})
+	}
+
+	return layout
+}
+
+// makeChartImage draws the given layout of the star history chart with the
+// given theme on the image.
+func makeChartImage(layout chartLayout, theme chartTheme) (image.Image, error) {
+	// Create the font faces (of the bundled Go Regular font) of the labels and the title.
+	parsed, err := helpLoadFont("")
+	if err != nil {
+		return nil, err
+	}
+	labelFace := truetype.NewFace(parsed, &truetype.Options{Size: chartFontSize, Hinting: font.HintingFull})
+	titleFace := truetype.NewFace(parsed, &truetype.Options{Size: chartTitleSize, Hinting: font.HintingFull})
+
+	// Create a new context filled with the background color.
+	ctx := gg.NewContext(chartWidth, chartHeight)
+	ctx.SetColor(theme.Background)
+	ctx.Clear()
+
+	// Draw the title and the total number of the stars.
+	ctx.SetFontFace(titleFace)
+	ctx.SetColor(theme.Text)
+	ctx.DrawStringAnchored(layout.Title, chartMarginLeft, chartMarginTop/2, 0, 0.35)
+	ctx.DrawStringAnchored(layout.Total, chartWidth-chartMarginRight, chartMarginTop/2, 1, 0.35)
+
+	// Draw the grid lines with the labels of the Y axis.
+	ctx.SetFontFace(labelFace)
+	ctx.SetLineWidth(1)
+	for _, tick := range layout.YTicks {
+		ctx.SetColor(theme.Grid)
+		ctx.DrawLine(chartMarginLeft, tick.Pos, chartWidth-chartMarginRight, tick.Pos)
+		ctx.Stroke()
+		ctx.SetColor(theme.Text)
+		ctx.DrawStringAnchored(tick.Label, chartMarginLeft-8, tick.Pos, 1, 0.35)
+	}
+
+	// Draw the labels of the X axis.
+	for index, tick := range layout.XTicks {
+		anchor := chartAnchor(index, len(layout.XTicks))
+		ctx.DrawStringAnchored(tick.Label, tick.Pos, chartHeight-chartMarginBottom+20, anchor, 0.35)
+	}
+
+	// Skip the line, if there are no points.
+	if len(layout.Line) == 0 {
+		return ctx.Image(), nil
+	}
+
+	bottom := float64(chartHeight - chartMarginBottom)
+	ctx.SetLineWidth(2)
+	ctx.SetLineJoinRound()
+	for _, run := range layout.runs() {
+		// Fill the area under the part of the line with the translucent color of the line.
+		ctx.MoveTo(run[0][0], bottom)
+		for _, point := range run {
+			ctx.LineTo(point[0], point[1])
+		}
+		ctx.LineTo(run[len(run)-1][0], bottom)
+		ctx.ClosePath()
+		ctx.SetColor(color.NRGBA{R: theme.Line.R, G: theme.Line.G, B: theme.Line.B, A: 0x33})
+		ctx.Fill()
+
+		// Draw the part of the line.
+		for _, point := range run {
+			ctx.LineTo(point[0], point[1])
+		}
+		ctx.SetColor(theme.Line)
+		ctx.Stroke()
+	}
+
+	// Draw the unknown ranges with the dashed line.
+	ctx.SetDash(6, 4)
+	for _, gap := range layout.Gaps {
+		ctx.DrawLine(layout.Line[gap-1][0], layout.Line[gap-1][1], layout.Line[gap][0], layout.Line[gap][1])
+		ctx.Stroke()
+	}
+	ctx.SetDash()
+
+	return ctx.Image(), nil
+}
+
+// makeChartSVG draws the given layout of the star history chart with the given
+// theme in the SVG format.
+func makeChartSVG(layout chartLayout, theme chartTheme) []byte {
+	var b strings.Builder
+
+	// Write the root element with the background.
+	fmt.Fprintf(
+		&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="%s" font-size="%g">`,
+		chartWidth, chartHeight, chartWidth, chartHeight, chartFontFamily, chartFontSize,
+	)
+	fmt.Fprintf(&b, `<title>%s</title>`, html.EscapeString(layout.Title))
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`, formatChartColor(theme.Background))
+
+	// Write the title and the total number of the stars.
+	fmt.Fprintf(
+		&b, `<text x="%d" y="%d" font-size="%g" font-weight="600" dominant-baseline="middle" fill="%s">%s</text>`,
+		chartMarginLeft, chartMarginTop/2, chartTitleSize, formatChartColor(theme.Text), html.EscapeString(layout.Title),
+	)
+	fmt.Fprintf(
+		&b, `<text x="%d" y="%d" font-size="%g" text-anchor="end" dominant-baseline="middle" fill="%s">%s</text>`,
+		chartWidth-chartMarginRight, chartMarginTop/2, chartTitleSize, formatChartColor(theme.Text),
+		html.EscapeString(layout.Total),
+	)
+
+	// Write the grid lines with the labels of the Y axis.
+	for _, tick := range layout.YTicks {
+		fmt.Fprintf(
+			&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="%s" stroke-width="1"/>`,
+			chartMarginLeft, tick.Pos, chartWidth-chartMarginRight, tick.Pos, formatChartColor(theme.Grid),
+		)
+		fmt.Fprintf(
+			&b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle" fill="%s">%s</text>`,
+			chartMarginLeft-8, tick.Pos, formatChartColor(theme.Text), html.EscapeString(tick.Label),
+		)
+	}
+
+	// Write the labels of the X axis.
+	anchors := map[float64]string{0: "start", 0.5: "middle", 1: "end"}
+	for index, tick := range layout.XTicks {
+		fmt.Fprintf(
+			&b, `<text x="%.1f" y="%d" text-anchor="%s" dominant-baseline="middle" fill="%s">%s</text>`,
+			tick.Pos, chartHeight-chartMarginBottom+20, anchors[chartAnchor(index, len(layout.XTicks))],
+			formatChartColor(theme.Text), html.EscapeString(tick.Label),
+		)
+	}
+
+	// Write the area under each part of the line and the part, if there are points.
+	if len(layout.Line) > 0 {
+		for _, run := range layout.runs() {
+			path := make([]string, 0, len(run))
+			for _, point := range run {
+				path = append(path, fmt.Sprintf("%.1f,%.1f", point[0], point[1]))
+			}
+			first, last := run[0][0], run[len(run)-1][0]
+			fmt.Fprintf(
+				&b, `<path d="M%.1f,%d L%s L%.1f,%dZ" fill="%s" fill-opacity="0.2"/>`,
+				first, chartHeight-chartMarginBottom, strings.Join(path, " L"), last, chartHeight-chartMarginBottom,
+				formatChartColor(theme.Line),
+			)
+			fmt.Fprintf(
+				&b, `<path d="M%s" fill="none" stroke="%s" stroke-width="2" stroke-linejoin="round"/>`,
+				strings.Join(path, " L"), formatChartColor(theme.Line),
+			)
+		}
+
+		// Write the unknown ranges with the dashed line.
+		for _, gap := range layout.Gaps {
+			fmt.Fprintf(
+				&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="2" stroke-dasharray="6 4"/>`,
+				layout.Line[gap-1][0], layout.Line[gap-1][1], layout.Line[gap][0], layout.Line[gap][1],
+				formatChartColor(theme.Line),
+			)
+		}
+	}
+
+	b.WriteString(`</svg>`)
+
+	return []byte(b.String())
+}
+
+// chartAnchor returns the horizontal anchor of the label of the X axis with
+// the given index, so the first and the last labels stay within the chart.
+func chartAnchor(index, count int) float64 {
+	switch index {
+	case 0:
+		return 0
+	case count - 1:
+		return 1
+	}
+
+	return 0.5
+}
+
+// chartStep returns the "nice" step of the ticks (1, 2 or 5 multiplied by the
+// power of ten) for the given raw step, at least 1.
+func chartStep(raw float64) float64 {
+	if raw <= 1 {
+		return 1
+	}
+
+	exponent := math.Pow(10, math.Floor(math.Log10(raw)))
+	switch fraction := raw / exponent; {
+	case fraction <= 1:
+		return exponent
+	case fraction <= 2:
+		return 2 * exponent
+	case fraction <= 5:
+		return 5 * exponent
+	}
+
+	return 10 * exponent
+}
+
+// formatChartCount formats the given number of the stars for the labels of
+// the axis (e.g., "950", "1.2k" or "3M").
+func formatChartCount(count int) string {
+	switch {
+	case count >= 1_000_000:
+		return strconv.FormatFloat(float64(count)/1_000_000, 'f', -1, 64) + "M"
+	case count >= 1_000:
+		return strconv.FormatFloat(float64(count)/1_000, 'f', -1, 64) + "k"
+	}
+
+	return strconv.Itoa(count)
+}
+
+// formatChartNumber formats the given number with the thousands separators
+// (e.g., "12,345").
+func formatChartNumber(number int) string {
+	digits := strconv.Itoa(number)
+	for index := len(digits) - 3; index > 0; index -= 3 {
+		digits = digits[:index] + "," + digits[index:]
+	}
+
+	return digits
+}
+
+// formatChartColor formats the given color in the hex format (e.g., "#ffffff").
+func formatChartColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// errFlightTimeout is returned when the in-flight call is not done before the
+// timeout of the waiting caller.
+var errFlightTimeout = errors.New("in-flight call is not done yet")
+
+// flightGroup is a struct that represents a group of in-flight calls (in the
+// style of the singleflight package). The concurrent calls with the same key
+// are coalesced into one call, and all callers get its result.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall represents an in-flight (or done) call of the group.
+type flightCall struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// newFlightGroup creates a new empty flightGroup.
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// do starts the given function in a separate goroutine for the given key and
+// returns its call. If there is an in-flight call for the same key, it is
+// returned instead, and the function is not started.
+//
+// The function keeps running after the waiting callers are timed out, so its
+// result (e.g., a fetched repository) is not lost for the next callers.
+func (g *flightGroup) do(key string, fn func() (any, error)) *flightCall {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Return the in-flight call, if it exists.
+	if call, ok := g.calls[key]; ok {
+		return call
+	}
+
+	// Create a new call and add it to the group.
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+
+	// Start the function in a separate goroutine.
+	go func() {
+		// Run the function and save its result (a panic of the function is saved as its error).
+		call.value, call.err = flightRun(fn)
+
+		// Remove the call from the group and signal that the call is done.
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	return call
+}
+
+// flightRun runs the given function and returns its result. A panic of the
+// function (e.g., in a render or a decode) is recovered and returned as the
+// error, because the net/http server cannot recover it in the goroutine of the
+// call, and it would kill the whole process.
+func flightRun(fn func() (any, error)) (value any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("in-flight call panicked", "details", fmt.Sprint(r), "stack", string(debug.Stack()))
+			value, err = nil, fmt.Errorf("in-flight call panicked (%v)", r)
+		}
+	}()
+
+	return fn()
+}
+
+// wait waits for the result of the call. If the timeout is not 0 and the call
+// is not done before the timeout, it returns the errFlightTimeout error.
+func (call *flightCall) wait(timeout time.Duration) (any, error) {
+	// Wait for the result without the timeout, if it is not set.
+	if timeout == 0 {
+		<-call.done
+		return call.value, call.err
+	}
+
+	// Create a new timer with the timeout.
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// Wait for the result or the timeout.
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-timer.C:
+		return nil, errFlightTimeout
+	}
+}
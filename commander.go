@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// commandSettings is a map of the values of the command-line flags by the
+// names of the environment variables (e.g., "AVATAR_SIZE"). It is used by the
+// helpGetEnv function with the highest priority.
+var commandSettings = map[string]string{}
+
+// commandEnvVariables is the list of the environment variables, which are
+// mirrored by the command-line flags (e.g., "--avatar-size" for the
+// "AVATAR_SIZE" environment variable), with the usage of each flag.
+var commandEnvVariables = []struct {
+	name, usage string
+}{
+	{"CONFIG_FILE", "path to the configuration file (.yaml, .yml or .toml)"},
+	{"CONFIG_WATCH_INTERVAL", "interval to check the configuration file for changes (in seconds, 0 to disable)"},
+	{"GITHUB_TOKEN", "token for the GitHub API"},
+	{"GITHUB_MAX_PAGES", "max number of pages (with 100 users per page) to fetch from the GitHub API"},
+	{"GITHUB_WEBHOOK_SECRET", "secret of the GitHub webhook (empty to disable the webhook endpoint)"},
+	{"GITHUB_WEBHOOK_DEBOUNCE", "time to wait for more webhook events before the refresh (in seconds)"},
+	{"STATE_DIR", "directory to persist the last good state of the repositories and restore it at startup"},
+	{"REPOSITORY_OWNER", "owner of the default repository on GitHub"},
+	{"REPOSITORY_NAME", "name of the default repository on GitHub"},
+	{"REPOSITORY_ALLOWLIST", "comma-separated list of owners or repositories to serve on demand"},
+	{"REPOSITORY_IDLE_TIMEOUT", "time after which an unused repository is evicted (in seconds)"},
+	{"REPOSITORY_FETCH_TIMEOUT", "time to wait for the first fetch of a repository (in seconds, 0 to wait)"},
+	{"SERVER_PORT", "port for the server"},
+	{"SERVER_READ_TIMEOUT", "HTTP read timeout for the server (in seconds)"},
+	{"SERVER_WRITE_TIMEOUT", "HTTP write timeout for the server (in seconds)"},
+	{"SERVER_SHUTDOWN_TIMEOUT", "time to drain the in-flight requests on shutdown (in seconds)"},
+	{"ADMIN_TOKEN", "bearer token for the admin API (empty to disable it)"},
+	{"ADMIN_REFRESH_COOLDOWN", "min time between the forced refreshes of one repository (in seconds)"},
+	{"NOTIFY_WEBHOOK_URL", "URL of the generic JSON webhook for the notifications about new and lost users"},
+	{"NOTIFY_SLACK_WEBHOOK_URL", "URL of the Slack-compatible incoming webhook for the notifications"},
+	{"NOTIFY_DISCORD_WEBHOOK_URL", "URL of the Discord-compatible webhook for the notifications"},
+	{"STAR_HISTORY_THEME", "default theme of the star history chart (light, dark)"},
+	{"STAR_HISTORY_RANGE", "default time range of the star history chart (all, or e.g. 30d, 12w, 6m, 1y)"},
+	{"STAR_HISTORY_LINE_COLOR", "color of the line of the star history chart (empty for the color of the theme)"},
+	{"STAR_HISTORY_BACKGROUND_COLOR", "background color of the star history chart (empty for the color of the theme)"},
+	{"STAR_HISTORY_BACKFILL_PAGES", "max number of pages of stargazers to backfill the star history (0 to disable)"},
+	{"AVATAR_SHAPE", "shape type for the one user avatar (rounded, circular, square)"},
+	{"AVATAR_SIZE", "size for the one user avatar (in pixels)"},
+	{"AVATAR_HORIZONTAL_MARGIN", "horizontal margin for the one user avatar (in pixels)"},
+	{"AVATAR_VERTICAL_MARGIN", "vertical margin for the one user avatar (in pixels)"},
+	{"AVATAR_ROUNDED_RADIUS", "radius of corners for the one user avatar (in pixels)"},
+	{"AVATAR_LABEL", "position of the login of the user (none, below, beside)"},
+	{"AVATAR_LABEL_FONT", "path to the TrueType font of the logins (empty for the bundled Go Regular font)"},
+	{"AVATAR_LABEL_SIZE", "font size of the logins (in pixels)"},
+	{"AVATAR_LABEL_WIDTH", "max width of the logins beside the avatars (in pixels)"},
+	{"AVATAR_LABEL_COLOR", "color of the logins"},
+	{"OUTPUT_IMAGE_MAX_PER_ROW", "max number of avatars per row for the output image"},
+	{"OUTPUT_IMAGE_MAX_ROWS", "max number of rows with avatars for the output image"},
+	{"OUTPUT_IMAGE_UPDATE_INTERVAL", "update interval for the output images (in seconds)"},
+	{"OUTPUT_IMAGE_JPEG_QUALITY", "quality of the output image in the JPEG format (from 1 to 100)"},
+	{"OUTPUT_IMAGE_BACKGROUND_COLOR", "background color of the output image in the JPEG format"},
+	{"OUTPUT_IMAGE_PNG_COMPRESSION", "compression level of the PNG encoder (default, none, speed, best)"},
+	{"OUTPUT_IMAGE_PNG_COLORS", "number of colors of the paletted PNG output (0 for the true color)"},
+	{"OUTPUT_IMAGE_PNG_MAX_SIZE", "size budget of the PNG output (in KB, 0 to disable)"},
+	{"OUTPUT_IMAGE_CACHE_SIZE", "max number of the rendered image variants kept in the LRU cache"},
+}
+
+// command represents the subcommand of the application with its description
+// and the function to run it with the arguments after its name.
+type command struct {
+	name, description string
+	run               func(args []string) error
+}
+
+// commands returns the list of the subcommands of the application.
+func commands() []command {
+	return []command{
+		{"serve", "run the HTTP server (the default command)", runServer},
+		{"render", "fetch the statistics once and write the images to a directory", runRender},
+		{"fetch", "fetch the statistics once and dump the users to a snapshot", runFetch},
+		{"validate-config", "validate the configuration and report all problems at once", runValidateConfig},
+		{"version", "print the version of the application", runVersion},
+	}
+}
+
+// runCommand runs the subcommand of the application from the given arguments
+// (e.g., "render --out ./assets"). If the arguments start with a flag or are
+// empty, the "serve" command is run.
+func runCommand(args []string) error {
+	// Print the usage of the application, if it is requested.
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		commandUsage()
+		return nil
+	}
+
+	// Select the command by its name (the "serve" command by default).
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name != name {
+			continue
+		}
+
+		// Run the command, and skip the error of the requested help.
+		if err := cmd.run(args); err != nil && !errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+
+		return nil
+	}
+
+	commandUsage()
+
+	return fmt.Errorf("unknown command '%s'", name)
+}
+
+// commandUsage prints the usage of the application with the list of the
+// subcommands.
+func commandUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, cmd := range commands() {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> --help' to see the flags of the command.\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Each flag mirrors the environment variable (e.g., --avatar-size for AVATAR_SIZE) and overrides it.")
+}
+
+// commandFlags creates a new set of the flags for the given command. If the
+// withConfig argument is true, the set contains the flags, which mirror the
+// environment variables.
+func commandFlags(name, description string, withConfig bool) *flag.FlagSet {
+	// Create a new set of the flags, which returns the errors to the caller.
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [flags]\n\n%s.\n\nFlags:\n", filepath.Base(os.Args[0]), name, description)
+		flags.PrintDefaults()
+	}
+
+	// Add the flags, which mirror the environment variables, if needed.
+	if withConfig {
+		for _, variable := range commandEnvVariables {
+			flags.Func(
+				strings.ReplaceAll(strings.ToLower(variable.name), "_", "-"),
+				fmt.Sprintf("%s (env %s)", variable.usage, variable.name),
+				func(value string) error {
+					commandSettings[variable.name] = value
+					return nil
+				},
+			)
+		}
+	}
+
+	return flags
+}
+
+// commandParse parses the given arguments by the given set of the flags. It
+// returns an error, if the arguments contain anything but the flags.
+func commandParse(flags *flag.FlagSet, args []string) error {
+	// Parse the flags from the arguments.
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Check, if there are no unexpected arguments.
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments %v for command '%s'", flags.Args(), flags.Name())
+	}
+
+	return nil
+}
+
+// runValidateConfig runs the "validate-config" command: it validates the
+// configuration from the flags, environment variables and configuration file,
+// and returns an error with all problems, if any.
+func runValidateConfig(args []string) error {
+	// Parse the arguments of the command.
+	flags := commandFlags("validate-config", "Validate the configuration and report all problems at once", true)
+	if err := commandParse(flags, args); err != nil {
+		return err
+	}
+
+	// Validate environment variables and create a new application.
+	app, err := validateEnvVariables()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"configuration is valid (default repository %s, %d declared repositories)\n",
+		app.Repository.String(), len(app.Repositories.Declared),
+	)
+
+	return nil
+}
+
+// runVersion runs the "version" command: it prints the version of the
+// application.
+func runVersion(args []string) error {
+	// Parse the arguments of the command.
+	flags := commandFlags("version", "Print the version of the application", false)
+	if err := commandParse(flags, args); err != nil {
+		return err
+	}
+
+	fmt.Printf("wonderful-readme-stats %s (commit %s, built at %s)\n", version, commit, date)
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"time"
+)
+
+// feedMaxEntries is the max number of the entries in the Atom feed (the newest
+// entries first).
+const feedMaxEntries = 50
+
+// feedTagAuthority is the prefix of the tag URIs (RFC 4151), which are the IDs
+// of the Atom feeds (the entries are tagged by the date of their event). The
+// IDs do not depend on the URL of the feed, so they stay the same behind any
+// host or proxy.
+const feedTagAuthority = "tag:github.com,2008:"
+
+// feedLink is a struct that represents the link of the Atom feed or entry.
+type feedLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// feedPerson is a struct that represents the author of the Atom entry.
+type feedPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+// feedContent is a struct that represents the HTML content of the Atom entry.
+type feedContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// feedEntry is a struct that represents the entry of the Atom feed (one new
+// user of the repository).
+type feedEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  feedPerson  `xml:"author"`
+	Links   []feedLink  `xml:"link"`
+	Content feedContent `xml:"content"`
+}
+
+// feed is a struct that represents the Atom feed with the new users of the
+// repository.
+type feed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []feedLink  `xml:"link"`
+	Entries []feedEntry `xml:"entry"`
+}
+
+// makeFeed makes the Atom feed with the new users of the given image from the
+// given history of the repository: the new stargazers (with the time of
+// starring) or the first-time contributors (with the time when they were seen
+// first). The users are filtered by the filters of the image, and the feed is
+// served from the given URL (it is used only for the "self" link).
+func makeFeed(history []historyEvent, repo *repository, def *imageDefinition, self string, updatedAt time.Time) feed {
+	// Set the title and the action of the feed by the source of the image.
+	title, action := fmt.Sprintf("New stargazers of %s", repo.String()), "starred"
+	if def.Source == "contributors" {
+		title, action = fmt.Sprintf("First-time contributors of %s", repo.String()), "made the first contribution to"
+	}
+
+	// Create a new feed.
+	result := feed{
+		ID:    feedTagAuthority + repo.String() + "/" + def.Name,
+		Title: title,
+		Links: []feedLink{
+			{Rel: "self", Type: "application/atom+xml", Href: self},
+			{Rel: "alternate", Type: "text/html", Href: "https://github.com/" + repo.String()},
+		},
+		Entries: make([]feedEntry, 0),
+	}
+
+	// Create a definition to filter the new users by the filters of the image (the number of contributions at the
+	// time when the user was seen first does not matter).
+	filter := *def
+	filter.Order, filter.Filters.MinContributions = "default", 0
+
+	// Add the new users of the events to the feed, from the newest event to the oldest one.
+	latest := updatedAt
+	for index := len(history) - 1; index >= 0 && len(result.Entries) < feedMaxEntries; index-- {
+		event := history[index]
+
+		// Select the new users of the event by the source of the image.
+		users := event.NewStargazers
+		if def.Source == "contributors" {
+			users = event.NewContributors
+		}
+
+		// Convert the users to filter them.
+		avatars := make([]UserAvatar, 0, len(users))
+		for _, user := range users {
+			avatar := UserAvatar{Login: user.Login, Type: user.Type, URL: user.AvatarURL, ProfileURL: user.ProfileURL}
+			if user.StarredAt != nil {
+				avatar.StarredAt = *user.StarredAt
+			}
+			avatars = append(avatars, avatar)
+		}
+
+		for _, avatar := range prepareImageAvatars(avatars, &filter) {
+			// Set the time of the entry: the time of starring, or the time when the user was seen first.
+			at := event.CreatedAt
+			if !avatar.StarredAt.IsZero() {
+				at = avatar.StarredAt
+			}
+			if at.After(latest) {
+				latest = at
+			}
+
+			result.Entries = append(result.Entries, feedEntry{
+				ID: fmt.Sprintf(
+					"tag:github.com,%s:%s/%s/%s/%s", event.CreatedAt.UTC().Format(time.DateOnly), repo.String(),
+					def.Source, event.ID, avatar.Login,
+				),
+				Title:   fmt.Sprintf("%s %s %s", avatar.Login, action, repo.String()),
+				Updated: at.UTC().Format(time.RFC3339),
+				Author:  feedPerson{Name: avatar.Login, URI: avatar.ProfileURL},
+				Links: []feedLink{
+					{Rel: "alternate", Type: "text/html", Href: avatar.ProfileURL},
+					{Rel: "enclosure", Type: "image/png", Href: avatar.URL},
+				},
+				Content: feedContent{
+					Type: "html",
+					Body: fmt.Sprintf(
+						`<p><img src="%s" alt="%s" width="64" height="64"></p><p><a href="%s">%s</a> %s %s.</p>`,
+						html.EscapeString(avatar.URL), html.EscapeString(avatar.Login), html.EscapeString(avatar.ProfileURL),
+						html.EscapeString(avatar.Login), action, html.EscapeString(repo.String()),
+					),
+				},
+			})
+
+			// Stop at the max number of the entries.
+			if len(result.Entries) == feedMaxEntries {
+				break
+			}
+		}
+	}
+
+	// Set the time of the last update of the feed.
+	result.Updated = latest.UTC().Format(time.RFC3339)
+
+	return result
+}
@@ -2,90 +2,355 @@ package main
 
 import (
 	"fmt"
-	"image"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
 )
 
-// ImageStore is a struct that represents the store of avatar images.
+// githubAPIURL is the base URL of the GitHub API.
+var githubAPIURL = "https://api.github.com"
+
+// rateLimit represents the last known rate limit of the GitHub API (from the
+// X-RateLimit-* headers of the last response).
+type rateLimit struct {
+	mu                 sync.RWMutex
+	Limit, Remaining   int
+	ResetAt, UpdatedAt time.Time
+}
+
+// githubRateLimit is the last known rate limit of the GitHub API.
+var githubRateLimit = &rateLimit{}
+
+// update updates the rate limit from the given headers of the GitHub API
+// response. The headers without the rate limit (e.g., of the avatar images)
+// are skipped.
+func (l *rateLimit) update(header http.Header) {
+	// Parse the remaining number of requests, if it exists.
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	// Parse the limit and the time of the reset (in UTC epoch seconds).
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.Limit, l.Remaining, l.ResetAt, l.UpdatedAt = limit, remaining, time.Unix(reset, 0).UTC(), time.Now()
+}
+
+// get returns a copy of the last known rate limit, and false if the rate limit
+// is not known yet.
+func (l *rateLimit) get() (limit, remaining int, resetAt time.Time, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.Limit, l.Remaining, l.ResetAt, !l.UpdatedAt.IsZero()
+}
+
+// ImageStore is a struct that represents the store of avatar images. The
+// complete flags are set for the sources, which were fetched up to their last
+// page, and MaxPages is the max number of pages they were fetched with.
 type ImageStore struct {
-	Stargazers, Contributors []image.Image
+	Stargazers, Contributors                 []UserAvatar
+	StargazersComplete, ContributorsComplete bool
+	MaxPages                                 int
+}
+
+// bySource returns the users of the store for the given source ("stargazers"
+// or "contributors").
+func (s ImageStore) bySource(source string) []UserAvatar {
+	if source == "contributors" {
+		return s.Contributors
+	}
+
+	return s.Stargazers
+}
+
+// complete checks, if the users of the given source ("stargazers" or
+// "contributors") were fetched up to the last page, so no users are cut off by
+// the max number of pages.
+func (s ImageStore) complete(source string) bool {
+	if source == "contributors" {
+		return s.ContributorsComplete
+	}
+
+	return s.StargazersComplete
+}
+
+// fetchImages fetches the users of the given repository, and the avatar images of the users, who will be rendered
+// by the images of the repository (see the prepareStoreImages function).
+// It returns an ImageStore and an error if any.
+func (c *Config) fetchImages(repo *repository) (ImageStore, error) {
+	// Fetch the users of the repository.
+	store, err := c.fetchUsersStore(repo)
+	if err != nil {
+		return ImageStore{}, err
+	}
+
+	return c.prepareStoreImages(repo, store, ImageStore{}), nil
 }
 
-// fetchImages fetches the avatar images of the stargazers, forks, and contributors of the repository.
+// fetchUsersStore fetches the stargazers and contributors of the given repository (without the avatar images).
+// Only the sources, which are used by the images of the repository, are fetched.
 // It returns an ImageStore and an error if any.
-func (c *Config) fetchImages() (ImageStore, error) {
+func (c *Config) fetchUsersStore(repo *repository) (ImageStore, error) {
 	// Create a new  URL for the GitHub API.
-	githubBaseUrl := fmt.Sprintf("https://api.github.com/repos/%s/%s", c.Repository.Owner, c.Repository.Name)
-	stargazersGithubUrl := fmt.Sprintf("%s/stargazers", githubBaseUrl)
-	contributorsGithubUrl := fmt.Sprintf("%s/contributors", githubBaseUrl)
+	githubBaseUrl := fmt.Sprintf("%s/repos/%s/%s", githubAPIURL, repo.Owner, repo.Name)
+
+	// Create a store for the avatar images and a slice of channels for the errors.
+	store := ImageStore{
+		Stargazers: make([]UserAvatar, 0), Contributors: make([]UserAvatar, 0), MaxPages: c.GithubMaxPages,
+	}
+	errChans := make([]<-chan error, 0, 2)
 
 	// Fetch the avatar images of stargazers and contributors concurrently.
-	stargazers := c.fetchAvatarImages(stargazersGithubUrl)
-	contributors := c.fetchAvatarImages(contributorsGithubUrl)
-
-	// Collect the avatar images from the channels.
-	return ImageStore{
-		Stargazers:   helpCollectImages(stargazers),
-		Contributors: helpCollectImages(contributors),
-	}, nil
+	var stargazers, contributors <-chan UserAvatar
+	var stargazersComplete, contributorsComplete <-chan bool
+	if repo.usesSource("stargazers") {
+		var errChan <-chan error
+		stargazers, stargazersComplete, errChan = c.fetchAvatarImages(
+			fmt.Sprintf("%s/stargazers", githubBaseUrl), true, repo.usesOrder("stargazers", "newest"),
+		)
+		errChans = append(errChans, errChan)
+	}
+	if repo.usesSource("contributors") {
+		var errChan <-chan error
+		contributors, contributorsComplete, errChan = c.fetchAvatarImages(
+			fmt.Sprintf("%s/contributors", githubBaseUrl), false, false,
+		)
+		errChans = append(errChans, errChan)
+	}
+
+	// Collect the avatar images from the channels, and check, if they were fetched up to the last page.
+	if stargazers != nil {
+		store.Stargazers = helpCollectAvatars(stargazers)
+		store.StargazersComplete = helpCollectComplete(stargazersComplete)
+	}
+	if contributors != nil {
+		store.Contributors = helpCollectAvatars(contributors)
+		store.ContributorsComplete = helpCollectComplete(contributorsComplete)
+	}
+
+	// Check, if there were errors while fetching the avatar images.
+	for _, errChan := range errChans {
+		select {
+		case err := <-errChan:
+			return ImageStore{}, err
+		default:
+		}
+	}
+
+	return store, nil
+}
+
+// starredUser is a struct that represents the stargazer in the star+json media type of the GitHub API.
+type starredUser struct {
+	StarredAt time.Time  `json:"starred_at"`
+	User      UserAvatar `json:"user"`
 }
 
-// fetchAvatarImages fetches the avatar images from the specified URL and returns a channel of image.Image.
-func (c *Config) fetchAvatarImages(url string) <-chan image.Image {
-	// Create a channel to send the avatar images.
-	imagesChan := make(chan image.Image)
+// fetchAvatarImages fetches the users with the URLs of their avatar images from the specified URL and returns a
+// channel of UserAvatar, a channel of the complete flag (true, if the users were fetched up to the last page) and a
+// channel of error. The users are sent to the channel in the same order as they were returned by the GitHub API.
+// The complete flag or the error is sent before the channel of users is closed. The avatar images are not downloaded
+// (see the prepareStoreImages function).
+//
+// If the starred argument is true, the users are requested with the star+json media type to get the time when
+// each user starred the repository. If the newest argument is true, the last pages are fetched instead of the first
+// ones (see the fetchUsers function).
+func (c *Config) fetchAvatarImages(url string, starred, newest bool) (<-chan UserAvatar, <-chan bool, <-chan error) {
+	// Create channels to send the avatar images, the complete flag and the error.
+	avatarsChan := make(chan UserAvatar)
+	completeChan := make(chan bool, 1)
+	errChan := make(chan error, 1)
 
 	// Start a goroutine to fetch the avatar images.
 	go func() {
-		// Download file from the given URL.
-		resp, err := c.helpCustomHTTPClient(url)
+		// Fetch the users from all pages of the given URL.
+		avatars, complete, err := c.fetchUsers(url, starred, c.GithubMaxPages, newest)
 		if err != nil {
 			// If there is an error, log the error message, close the channel, and return.
 			slog.Error("failed to fetch avatar images", "url", url, "details", err.Error())
-			close(imagesChan)
+			errChan <- err
+			close(avatarsChan)
 			return
 		}
-		defer resp.Body.Close()
 
-		// Check, if the response status code is not 200.
-		if resp.StatusCode != http.StatusOK {
-			// If the status code is not 200, log the error message, close the channel, and return.
-			slog.Error("failed to fetch avatar images", "url", url, "status_code", resp.StatusCode)
-			close(imagesChan)
-			return
+		// Send each user with the avatar image to the avatarsChan channel, and the complete flag.
+		for _, avatar := range avatars {
+			avatarsChan <- avatar
 		}
+		completeChan <- complete
 
-		// Create a slice of UserAvatar structs to store the avatar images.
-		avatars := make([]UserAvatar, 0)
+		// Close the channel to signal that we are done sending images.
+		close(avatarsChan)
+	}()
 
-		// Decode the response body into a slice of UserAvatar structs.
-		if err := jsoniter.ConfigCompatibleWithStandardLibrary.NewDecoder(resp.Body).Decode(&avatars); err != nil {
-			// If there is an error decoding the response, log the error message, close the channel, and return.
-			slog.Error("failed to unmarshal avatar images", "details", err.Error())
-			close(imagesChan)
-			return
+	return avatarsChan, completeChan, errChan
+}
+
+// fetchUsers fetches the users from the specified URL of the GitHub API. It follows the "next" links of the
+// pagination (with 100 users per page) up to the given max number of pages. It returns true, if the users were
+// fetched up to the last page (no "next" link is left), so no users are cut off by the max number of pages.
+//
+// The GitHub API lists the stargazers from the oldest one, so if the newest argument is true and the users do not
+// fit the given number of pages, the last pages (by the "last" link of the first page) are fetched instead, so the
+// newest users are not cut off.
+func (c *Config) fetchUsers(url string, starred bool, pages int, newest bool) ([]UserAvatar, bool, error) {
+	// Create a slice of UserAvatar structs to store the users.
+	avatars := make([]UserAvatar, 0)
+
+	// Iterate over the pages of the given URL.
+	next := fmt.Sprintf("%s?per_page=100", url)
+	for page := 1; next != "" && page <= pages; page++ {
+		// Fetch the users of the page.
+		users, link, err := c.fetchUsersPage(next, starred)
+		if err != nil {
+			return nil, false, err
 		}
+		avatars = append(avatars, users...)
+
+		// Set the URL of the next page from the Link header.
+		next = helpParseLink(link, "next")
+
+		// Fetch the last pages instead, if the newest users are needed and they do not fit the pages (so the oldest
+		// users are cut off). They are fetched from the page before the last pages, because the last page is usually
+		// not full. If it is the first page, its users are reused, and the pages are fetched from the next one.
+		if page == 1 && newest {
+			last := helpParseLink(link, "last")
+			if first := helpPageLink(last, -pages); first != "" {
+				fetched := []UserAvatar(nil)
+				if helpPageLink(last, -pages-1) == "" {
+					first, fetched = next, avatars
+				}
+				avatars, err := c.fetchNewestUsers(first, fetched, starred, pages)
+				return avatars, false, err
+			}
+		}
+	}
+
+	return avatars, next == "", nil
+}
 
-		// Prepare the avatar images.
-		images, err := c.prepareAvatarImages(avatars)
+// fetchNewestUsers fetches the users from the given URL of the page to the last page after the given already fetched
+// users (of the pages before it), and returns the newest users, which fit the given number of pages.
+func (c *Config) fetchNewestUsers(first string, fetched []UserAvatar, starred bool, pages int) ([]UserAvatar, error) {
+	// Create a slice of UserAvatar structs to store the users.
+	avatars := append(make([]UserAvatar, 0, len(fetched)), fetched...)
+
+	// Iterate over the pages from the given one to the last one.
+	for page, next := 0, first; next != "" && page <= pages; page++ {
+		// Fetch the users of the page.
+		users, link, err := c.fetchUsersPage(next, starred)
 		if err != nil {
-			// If there is an error preparing the avatar images, log the error message, close the channel, and return.
-			slog.Error("failed to prepare avatar images", "details", err.Error())
-			close(imagesChan)
-			return
+			return nil, err
 		}
+		avatars = append(avatars, users...)
+
+		// Set the URL of the next page from the Link header.
+		next = helpParseLink(link, "next")
+	}
+
+	return avatars[max(0, len(avatars)-pages*100):], nil
+}
+
+// fetchUsersPage fetches the users of the page with the given URL of the GitHub API. It returns the users with the
+// Link header of the page (with the links to the next and last pages).
+func (c *Config) fetchUsersPage(uri string, starred bool) ([]UserAvatar, string, error) {
+	// Set the media type to get the time of starring, if needed.
+	accept := ""
+	if starred {
+		accept = "application/vnd.github.star+json"
+	}
+
+	// Download file from the given URL.
+	resp, err := c.helpCustomHTTPClient(uri, accept)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	// Check, if the response status code is not 200.
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("wrong status code %d for %s", resp.StatusCode, uri)
+	}
 
-		// Send each image to the imagesChan channel.
-		for _, img := range images {
-			imagesChan <- img
+	// Decode the response body into a slice of UserAvatar structs.
+	users := make([]UserAvatar, 0)
+	if err := c.fetchDecodeAvatars(resp, starred, &users); err != nil {
+		return nil, "", err
+	}
+
+	return users, resp.Header.Get("Link"), nil
+}
+
+// fetchStargazersCount fetches the total number of the stargazers of the given repository from the GitHub API.
+func (c *Config) fetchStargazersCount(repo *repository) (int, error) {
+	// Download the repository from the GitHub API.
+	url := fmt.Sprintf("%s/repos/%s/%s", githubAPIURL, repo.Owner, repo.Name)
+	resp, err := c.helpCustomHTTPClient(url, "")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Check, if the response status code is not 200.
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("wrong status code %d for %s", resp.StatusCode, url)
+	}
+
+	// Decode the number of the stargazers from the response body.
+	data := struct {
+		StargazersCount int `json:"stargazers_count"`
+	}{}
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return 0, err
+	}
+
+	return data.StargazersCount, nil
+}
+
+// fetchDecodeAvatars decodes the body of the given response into the given slice of UserAvatar structs.
+// If the starred argument is true, the body is decoded as the star+json media type of the GitHub API.
+func (c *Config) fetchDecodeAvatars(resp *http.Response, starred bool, avatars *[]UserAvatar) error {
+	// Create a new JSON decoder for the response body.
+	decoder := jsoniter.ConfigCompatibleWithStandardLibrary.NewDecoder(resp.Body)
+
+	// Decode the response body directly, if the star+json media type is not used.
+	if !starred {
+		// Create a slice of UserAvatar structs to store the users of the page.
+		users := make([]UserAvatar, 0)
+
+		// Decode the response body into a slice of UserAvatar structs.
+		if err := decoder.Decode(&users); err != nil {
+			return err
 		}
 
-		// Close the channel to signal that we are done sending images.
-		close(imagesChan)
-	}()
+		*avatars = append(*avatars, users...)
+
+		return nil
+	}
+
+	// Create a slice of starredUser structs to store the stargazers.
+	stargazers := make([]starredUser, 0)
+
+	// Decode the response body into a slice of starredUser structs.
+	if err := decoder.Decode(&stargazers); err != nil {
+		return err
+	}
+
+	// Set the time of starring to each user.
+	for _, stargazer := range stargazers {
+		stargazer.User.StarredAt = stargazer.StarredAt
+		*avatars = append(*avatars, stargazer.User)
+	}
 
-	return imagesChan
+	return nil
 }
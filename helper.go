@@ -2,34 +2,48 @@ package main
 
 import (
 	"fmt"
-	"image"
+	"image/color"
+	"image/png"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/goregular"
 )
 
+// helpHTTPClient is the HTTP client with options, which is shared by all
+// requests to the GitHub API and the avatar images (so they reuse the pooled
+// connections). For more information, see
+// https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
+var helpHTTPClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost:   avatarMaxDownloads,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
 // helpCustomHTTPClient makes an HTTP request to download the image from the given URL and returns the response.
-func (c *Config) helpCustomHTTPClient(uri string) (*http.Response, error) {
+// If the accept argument is not empty, it is sent as the Accept header (e.g., to get a custom media type).
+func (c *Config) helpCustomHTTPClient(uri, accept string) (*http.Response, error) {
 	// Check, if the URL is valid.
 	_, err := url.Parse(uri)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a new HTTP client with options.
-	// For more information, see https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
-	client := &http.Client{
-		Timeout: 15 * time.Second,
-		Transport: &http.Transport{
-			TLSHandshakeTimeout:   10 * time.Second,
-			ResponseHeaderTimeout: 10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-	}
-
 	// Make an HTTP request to download the image from the given URL.
-	req, err := http.NewRequest(http.MethodGet, uri, http.NoBody)
+	// The request is canceled, when the application is shutting down.
+	req, err := http.NewRequestWithContext(shutdownContext, http.MethodGet, uri, http.NoBody)
 	if err != nil {
 		return nil, err
 	}
@@ -41,38 +55,310 @@ func (c *Config) helpCustomHTTPClient(uri string) (*http.Response, error) {
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.GithubToken))
 	}
 
+	// Set the accept header if a custom media type is provided.
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
 	// Send the request to the HTTP server.
-	resp, err := client.Do(req)
+	resp, err := helpHTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
+	// Remember the rate limit of the GitHub API from the response headers, if they exist.
+	githubRateLimit.update(resp.Header)
+
 	return resp, nil
 }
 
-// helpCollectImages collects the images from the given channel and returns a slice of image.Image.
-func helpCollectImages(imagesChan <-chan image.Image) []image.Image {
-	// Create an empty slice to store the collected images.
-	images := make([]image.Image, 0)
+// helpCollectAvatars collects the users with avatars from the given channel and returns a slice of UserAvatar.
+func helpCollectAvatars(avatarsChan <-chan UserAvatar) []UserAvatar {
+	// Create an empty slice to store the collected users.
+	avatars := make([]UserAvatar, 0)
 
-	// Iterate over the images in the channel until the channel is closed.
-	for img := range imagesChan {
-		// Append the current image to the images slice.
-		images = append(images, img)
+	// Iterate over the users in the channel until the channel is closed.
+	for avatar := range avatarsChan {
+		// Append the current user to the avatars slice.
+		avatars = append(avatars, avatar)
 	}
 
-	return images
+	return avatars
+}
+
+// helpCollectComplete returns the complete flag of the fetched users from the
+// given channel, or false if it is not sent (e.g., the fetch is failed).
+func helpCollectComplete(completeChan <-chan bool) bool {
+	select {
+	case complete := <-completeChan:
+		return complete
+	default:
+		return false
+	}
 }
 
 // helpGetEnv returns the value of the environment variable associated with the given key.
+// The value of the command-line flag, which mirrors the environment variable, takes precedence (if any).
+// If the environment variable does not exist, the value from the configuration file is returned (if any).
 func helpGetEnv(key, fallback string) string {
+	// Check if the command-line flag is set for the given key
+	value, ok := commandSettings[key]
+	if ok {
+		// If the flag is set, return its value
+		return value
+	}
+
 	// Check if the environment variable exists for the given key
-	value, ok := os.LookupEnv(key)
+	value, ok = os.LookupEnv(key)
 	if ok {
 		// If the environment variable exists, return its value
 		return value
 	}
 
+	// Check if the setting exists in the configuration file for the given key
+	value, ok = configFileSettings[key]
+	if ok {
+		// If the setting exists, return its value
+		return value
+	}
+
 	// If the environment variable does not exist, return the fallback value
 	return fallback
 }
+
+// helpParseHexColor parses the given color in the hex format (e.g., "#ffffff")
+// and returns a color.NRGBA. It returns an error, if the color is not valid.
+func helpParseHexColor(hex string) (color.NRGBA, error) {
+	// Parse the color value without the leading hash symbol.
+	value, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(hex, "#")) != 6 {
+		return color.NRGBA{}, fmt.Errorf("wrong hex color '%s' (must be in the #rrggbb format)", hex)
+	}
+
+	return color.NRGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}, nil
+}
+
+// helpFonts is a cache of the parsed fonts by their paths ("" for the bundled
+// Go Regular font).
+var helpFonts sync.Map
+
+// helpCachedFont represents the parsed font in the cache with the modification
+// time and the size of its file, when it was parsed.
+type helpCachedFont struct {
+	font    *truetype.Font
+	modTime time.Time
+	size    int64
+}
+
+// helpLoadFont loads and parses the TrueType font from the given path, or the
+// bundled Go Regular font, if the path is empty. The parsed fonts are cached
+// by their paths, and the font is parsed again, if the modification time or
+// the size of its file is changed (e.g., the file is replaced before the
+// configuration is reloaded).
+func helpLoadFont(path string) (*truetype.Font, error) {
+	// Check the modification time and the size of the font file, if the path is set.
+	var modTime time.Time
+	var size int64
+	var statErr error
+	if path != "" {
+		info, err := os.Stat(filepath.Clean(path))
+		if err == nil {
+			modTime, size = info.ModTime(), info.Size()
+		}
+		statErr = err
+	}
+
+	// Return the cached font, if it exists and its file is not changed (or cannot be read anymore).
+	if cached, ok := helpFonts.Load(path); ok {
+		if entry := cached.(helpCachedFont); statErr != nil || (entry.modTime.Equal(modTime) && entry.size == size) {
+			return entry.font, nil
+		}
+	}
+	if statErr != nil {
+		return nil, statErr
+	}
+
+	// Read the font from the given path, if it is set.
+	data := goregular.TTF
+	if path != "" {
+		read, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return nil, err
+		}
+		data = read
+	}
+
+	// Parse the font, and save it to the cache.
+	parsed, err := truetype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s (%s)", path, err.Error())
+	}
+	helpFonts.Store(path, helpCachedFont{font: parsed, modTime: modTime, size: size})
+
+	return parsed, nil
+}
+
+// helpParsePNGCompression parses the given name of the PNG compression level
+// ("default", "none", "speed" or "best") and returns a png.CompressionLevel.
+func helpParsePNGCompression(name string) (png.CompressionLevel, error) {
+	switch name {
+	case "default":
+		return png.DefaultCompression, nil
+	case "none":
+		return png.NoCompression, nil
+	case "speed":
+		return png.BestSpeed, nil
+	case "best":
+		return png.BestCompression, nil
+	}
+
+	return 0, fmt.Errorf("wrong PNG compression level '%s' (must be one of: default, none, speed, best)", name)
+}
+
+// requestedFile represents the parsed name of the requested file: the name of
+// the image (e.g., "stargazers"), the format and the scale factor (0 if it is
+// not set in the name).
+type requestedFile struct {
+	Name, Format string
+	Scale        int
+}
+
+// helpParseFileName parses the given name of the requested file (e.g.,
+// "stargazers@2x.png") and returns a requestedFile. An empty format means
+// that the name has no extension. It returns an error, if the name is not
+// valid. The name of the image is checked against the definitions of the
+// repository by the caller.
+func helpParseFileName(name string) (requestedFile, error) {
+	// Split the name into the base name and the extension.
+	base, extension, _ := strings.Cut(name, ".")
+
+	// Split the base name into the name of the image and the scale factor.
+	image, scale, hasScale := strings.Cut(base, "@")
+	if image == "" {
+		return requestedFile{}, fmt.Errorf("unknown file '%s'", name)
+	}
+
+	// Select the format by the extension.
+	file := requestedFile{Name: image}
+	switch extension {
+	case "", "png", "webp", "md", "html", "json", "atom":
+		file.Format = extension
+	case "jpg", "jpeg":
+		file.Format = "jpeg"
+	default:
+		return requestedFile{}, fmt.Errorf("unknown file extension '%s'", extension)
+	}
+
+	// Parse the scale factor, if it exists (for images only).
+	if hasScale {
+		if file.Format == "md" || file.Format == "html" || file.Format == "json" || file.Format == "atom" {
+			return requestedFile{}, fmt.Errorf("unknown file '%s'", name)
+		}
+
+		parsed, err := helpParseScale(strings.TrimSuffix(scale, "x"))
+		if err != nil || !strings.HasSuffix(scale, "x") {
+			return requestedFile{}, fmt.Errorf("unknown file '%s'", name)
+		}
+		file.Scale = parsed
+	}
+
+	return file, nil
+}
+
+// helpParseScale parses the given scale factor (from 1 to 3, 1 by default).
+// It returns an error, if the scale factor is not valid.
+func helpParseScale(value string) (int, error) {
+	// Return the default scale factor, if it is not set.
+	if value == "" {
+		return 1, nil
+	}
+
+	// Parse the scale factor.
+	scale, err := strconv.Atoi(value)
+	if err != nil || scale < 1 || scale > 3 {
+		return 0, fmt.Errorf("wrong scale '%s' (must be an integer from 1 to 3)", value)
+	}
+
+	return scale, nil
+}
+
+// helpParseRange parses the given time range of the star history: "all" for
+// the whole history (returned as 0), or the number with the unit (e.g., "30d",
+// "12w", "6m" or "1y"). It returns an error, if the time range is not valid.
+func helpParseRange(value string) (time.Duration, error) {
+	// Return 0 for the whole history.
+	if value == "all" {
+		return 0, nil
+	}
+
+	// Create a map of the units of the time range.
+	day := 24 * time.Hour
+	units := map[byte]time.Duration{'d': day, 'w': 7 * day, 'm': 30 * day, 'y': 365 * day}
+
+	// Parse the number and the unit of the time range.
+	if len(value) >= 2 {
+		number, err := strconv.Atoi(value[:len(value)-1])
+		unit, ok := units[value[len(value)-1]]
+		if err == nil && ok && number >= 1 && number <= 100 {
+			return time.Duration(number) * unit, nil
+		}
+	}
+
+	return 0, fmt.Errorf("wrong range '%s' (must be 'all' or a number from 1 to 100 with d, w, m or y, e.g. '6m')", value)
+}
+
+// helpSplitList splits the given comma-separated list into a slice of strings
+// without spaces and empty items.
+func helpSplitList(list string) []string {
+	// Create an empty slice to store the items.
+	items := make([]string, 0)
+
+	// Iterate over the items of the list.
+	for _, item := range strings.Split(list, ",") {
+		// Append the item to the items slice, if it is not empty.
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// helpParseLink parses the given Link header of the GitHub API and returns the URL of the page with the given
+// relation (e.g., "next" or "last"), or an empty string if there is no such page.
+func helpParseLink(header, rel string) string {
+	// Iterate over the links of the header (e.g., `<https://...?page=2>; rel="next"`).
+	for _, link := range strings.Split(header, ",") {
+		// Split the link into the URL and the parameters.
+		uri, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+		if !ok || !strings.Contains(params, `rel="`+rel+`"`) {
+			continue
+		}
+
+		return strings.Trim(strings.TrimSpace(uri), "<>")
+	}
+
+	return ""
+}
+
+// helpPageLink returns the given URL of the page of the GitHub API with the page number moved by the given offset
+// (e.g., -1 for the previous page). It returns an empty string, if the URL has no page number, or the moved page
+// number is before the first page.
+func helpPageLink(uri string, offset int) string {
+	// Parse the URL and its page number.
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	query := parsed.Query()
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page+offset < 1 {
+		return ""
+	}
+
+	// Set the moved page number.
+	query.Set("page", strconv.Itoa(page+offset))
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String()
+}
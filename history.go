@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// historyFile is the name of the file with the history of the changes of the
+// users in the state directory of the repository.
+const historyFile = "history.json"
+
+// historyMaxEvents is the max number of the events kept in the history of
+// each repository (the oldest events are dropped first).
+const historyMaxEvents = 100
+
+// historyUser represents the user in the event of the history.
+type historyUser struct {
+	Login      string     `json:"login"`
+	Type       string     `json:"type,omitempty"`
+	AvatarURL  string     `json:"avatar_url"`
+	ProfileURL string     `json:"profile_url"`
+	StarredAt  *time.Time `json:"starred_at,omitempty"`
+}
+
+// historyEvent represents the changes of the users of the repository between
+// two consecutive refreshes: the new and lost stargazers, and the first-time
+// contributors. The names of the notifiers, which delivered the event, are
+// saved with it, so the event is never sent twice (even after the restart).
+type historyEvent struct {
+	ID              string        `json:"id"`
+	Repository      string        `json:"repository"`
+	CreatedAt       time.Time     `json:"created_at"`
+	NewStargazers   []historyUser `json:"new_stargazers"`
+	LostStargazers  []historyUser `json:"lost_stargazers"`
+	NewContributors []historyUser `json:"new_contributors"`
+	Notified        []string      `json:"notified,omitempty"`
+}
+
+// makeHistoryEvent compares the given previous and next users of the given
+// repository, and returns the event with the changes. Only the sources, which
+// are used by the given fetched repository, are compared. It returns false, if
+// there are no changes.
+//
+// The users of a source are compared only, if both lists were fetched up to
+// their last page with the same max number of pages: otherwise, the users cut
+// off by the max number of pages (or moved over it) would be reported as the
+// lost or new ones.
+func makeHistoryEvent(fetched *repository, prev, next ImageStore) (historyEvent, bool) {
+	// Create a new event.
+	now := time.Now().UTC()
+	event := historyEvent{
+		ID:              fmt.Sprintf("%s/%d", registryKey(fetched.Owner, fetched.Name), now.UnixNano()),
+		Repository:      fetched.String(),
+		CreatedAt:       now,
+		NewStargazers:   make([]historyUser, 0),
+		LostStargazers:  make([]historyUser, 0),
+		NewContributors: make([]historyUser, 0),
+	}
+
+	// Compare the stargazers: the new ones and the lost ones.
+	if historyComparable(fetched, prev, next, "stargazers") {
+		event.NewStargazers = historyDiff(next.Stargazers, prev.Stargazers)
+		event.LostStargazers = historyDiff(prev.Stargazers, next.Stargazers)
+	}
+
+	// Compare the contributors: the first-time ones only.
+	if historyComparable(fetched, prev, next, "contributors") {
+		event.NewContributors = historyDiff(next.Contributors, prev.Contributors)
+	}
+
+	return event, len(event.NewStargazers)+len(event.LostStargazers)+len(event.NewContributors) > 0
+}
+
+// historyComparable checks, if the given previous and next users of the given
+// source can be compared: the source is used by the given fetched repository,
+// and both lists were fetched up to their last page with the same max number
+// of pages.
+func historyComparable(fetched *repository, prev, next ImageStore, source string) bool {
+	return fetched.usesSource(source) && prev.complete(source) && next.complete(source) && prev.MaxPages == next.MaxPages
+}
+
+// historyDiff returns the users of the first list, which are not in the second
+// one (compared by their logins).
+func historyDiff(users, others []UserAvatar) []historyUser {
+	// Collect the logins of the other users.
+	logins := make(map[string]struct{}, len(others))
+	for _, other := range others {
+		logins[other.Login] = struct{}{}
+	}
+
+	// Collect the users, which are not in the other users.
+	diff := make([]historyUser, 0)
+	for _, user := range users {
+		if _, ok := logins[user.Login]; ok {
+			continue
+		}
+
+		item := historyUser{Login: user.Login, Type: user.Type, AvatarURL: user.URL, ProfileURL: user.ProfileURL}
+		if !user.StarredAt.IsZero() {
+			starredAt := user.StarredAt
+			item.StarredAt = &starredAt
+		}
+		diff = append(diff, item)
+	}
+
+	return diff
+}
+
+// addHistory adds the given event to the history of the stats, and drops the
+// oldest events over the historyMaxEvents.
+func (s *Stats) addHistory(event historyEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.History = append(s.History, event)
+	if len(s.History) > historyMaxEvents {
+		s.History = slices.Clone(s.History[len(s.History)-historyMaxEvents:])
+	}
+}
+
+// history returns a copy of the history of the stats (from the oldest event to
+// the newest one).
+func (s *Stats) history() []historyEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.History)
+}
+
+// setHistory replaces the history of the stats (e.g., with the restored one).
+func (s *Stats) setHistory(history []historyEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.History = history
+}
+
+// markNotified remembers, that the event with the given ID was delivered by
+// the notifier with the given name.
+func (s *Stats) markNotified(id, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.History {
+		if s.History[i].ID == id && !slices.Contains(s.History[i].Notified, name) {
+			s.History[i].Notified = append(slices.Clone(s.History[i].Notified), name)
+		}
+	}
+}
+
+// writeHistory writes the given history to the given directory.
+func writeHistory(dir string, history []historyEvent) error {
+	data, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, historyFile), data, 0o644)
+}
+
+// readHistory reads the history from the given directory. It returns an empty
+// history, if the file does not exist.
+func readHistory(dir string) ([]historyEvent, error) {
+	history := make([]historyEvent, 0)
+
+	// Read the file of the history, if it exists.
+	data, err := os.ReadFile(filepath.Join(dir, historyFile))
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the history.
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to decode %s (%s)", historyFile, err.Error())
+	}
+
+	return history, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestMakeHistoryEvent(t *testing.T) {
+	fetched := &repository{
+		Owner: "koddr", Name: "wonderful-readme-stats",
+		Images: []*imageDefinition{{Name: "stargazers", Source: "stargazers"}},
+	}
+	users := func(logins ...string) []UserAvatar {
+		avatars := make([]UserAvatar, 0, len(logins))
+		for _, login := range logins {
+			avatars = append(avatars, UserAvatar{Login: login})
+		}
+		return avatars
+	}
+
+	tests := []struct {
+		name           string
+		prev, next     ImageStore
+		wantNew        int
+		wantLost       int
+		wantChanged    bool
+		wantComparable bool
+	}{
+		{
+			"complete lists",
+			ImageStore{Stargazers: users("a", "b"), StargazersComplete: true, MaxPages: 10},
+			ImageStore{Stargazers: users("b", "c"), StargazersComplete: true, MaxPages: 10},
+			1, 1, true, true,
+		},
+		{
+			"no changes",
+			ImageStore{Stargazers: users("a"), StargazersComplete: true, MaxPages: 10},
+			ImageStore{Stargazers: users("a"), StargazersComplete: true, MaxPages: 10},
+			0, 0, false, true,
+		},
+		{
+			"truncated previous list",
+			ImageStore{Stargazers: users("a", "b"), MaxPages: 10},
+			ImageStore{Stargazers: users("b", "c"), StargazersComplete: true, MaxPages: 10},
+			0, 0, false, false,
+		},
+		{
+			"truncated next list",
+			ImageStore{Stargazers: users("a", "b"), StargazersComplete: true, MaxPages: 10},
+			ImageStore{Stargazers: users("b", "c"), MaxPages: 10},
+			0, 0, false, false,
+		},
+		{
+			"changed max pages",
+			ImageStore{Stargazers: users("a", "b"), StargazersComplete: true, MaxPages: 10},
+			ImageStore{Stargazers: users("b", "c"), StargazersComplete: true, MaxPages: 5},
+			0, 0, false, false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, changed := makeHistoryEvent(fetched, tt.prev, tt.next)
+			if len(event.NewStargazers) != tt.wantNew || len(event.LostStargazers) != tt.wantLost {
+				t.Errorf(
+					"makeHistoryEvent() = %d new, %d lost, want %d new, %d lost",
+					len(event.NewStargazers), len(event.LostStargazers), tt.wantNew, tt.wantLost,
+				)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("makeHistoryEvent() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if got := historyComparable(fetched, tt.prev, tt.next, "stargazers"); got != tt.wantComparable {
+				t.Errorf("historyComparable() = %v, want %v", got, tt.wantComparable)
+			}
+		})
+	}
+}
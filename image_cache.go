@@ -0,0 +1,81 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache is a struct that represents a bounded cache of the encoded images
+// with the least recently used eviction policy.
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+// lruItem represents an item of the LRU cache.
+type lruItem struct {
+	key   string
+	value []byte
+}
+
+// newLRUCache creates a new LRU cache with the given capacity.
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{
+		capacity: max(capacity, 1),
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the value for the given key and marks it as the most recently
+// used one. It returns false, if the key does not exist.
+func (l *lruCache) get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Check, if the key exists.
+	element, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	// Move the item to the front of the list.
+	l.order.MoveToFront(element)
+
+	return element.Value.(*lruItem).value, true
+}
+
+// add adds the value for the given key to the cache. If the cache is full, the
+// least recently used item is evicted.
+func (l *lruCache) add(key string, value []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Update the value, if the key already exists.
+	if element, ok := l.items[key]; ok {
+		element.Value.(*lruItem).value = value
+		l.order.MoveToFront(element)
+		return
+	}
+
+	// Add a new item to the front of the list.
+	l.items[key] = l.order.PushFront(&lruItem{key: key, value: value})
+
+	// Evict the least recently used item, if the cache is full.
+	if l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruItem).key)
+	}
+}
+
+// purge removes all items from the cache.
+func (l *lruCache) purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.items = make(map[string]*list.Element)
+	l.order.Init()
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// imageContentTypes is a map of the supported output image formats and their
+// content types. The formats are listed by the preference of the server in
+// the imageFormatsOrder slice.
+var (
+	imageContentTypes = map[string]string{
+		"png":  "image/png",
+		"webp": "image/webp",
+		"jpeg": "image/jpeg",
+	}
+	imageFormatsOrder = []string{"webp", "png", "jpeg"}
+)
+
+// encodeImage encodes the given image to the given writer in the given format
+// ("png", "webp" or "jpeg").
+//
+// The JPEG format has no alpha channel, so the image is drawn over the
+// background color from the output image options before encoding.
+func (c *Config) encodeImage(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "png":
+		// Encode the image to PNG with the options of the PNG encoder.
+		return c.encodePNG(w, img)
+	case "webp":
+		// Encode the image to WebP (lossless).
+		return nativewebp.Encode(w, img, nil)
+	case "jpeg":
+		// Create a new image filled with the background color.
+		background := image.NewRGBA(img.Bounds())
+		draw.Draw(background, background.Bounds(), image.NewUniform(c.OutputImage.BackgroundColor), image.Point{}, draw.Src)
+
+		// Draw the image over the background.
+		draw.Draw(background, background.Bounds(), img, img.Bounds().Min, draw.Over)
+
+		// Encode the image to JPEG.
+		return jpeg.Encode(w, background, &jpeg.Options{Quality: c.OutputImage.JPEGQuality})
+	}
+
+	return fmt.Errorf("unknown output image format '%s'", format)
+}
+
+// pngSettings represents the settings of the PNG encoder: the compression
+// level and the number of colors of the paletted output (0 for the true color
+// output).
+type pngSettings struct {
+	Compression png.CompressionLevel
+	Colors      int
+}
+
+// encodePNG encodes the given image to the given writer in the PNG format with
+// the compression level and the number of colors from the output image
+// options.
+//
+// If the size budget is set, the function tries progressively smaller
+// settings (the best compression, then fewer colors of the palette) until the
+// encoded image fits under the budget. If no settings fit, the smallest result
+// is written.
+func (c *Config) encodePNG(w io.Writer, img image.Image) error {
+	// Set the settings from the output image options.
+	settings := []pngSettings{{Compression: c.OutputImage.PNGCompression, Colors: c.OutputImage.PNGColors}}
+
+	// Encode the image with the given settings only, if the size budget is not set.
+	if c.OutputImage.PNGMaxSize == 0 {
+		return encodePNGWithSettings(w, img, settings[0])
+	}
+
+	// Add the best compression with the same number of colors, if it is not set.
+	if c.OutputImage.PNGCompression != png.BestCompression {
+		settings = append(settings, pngSettings{Compression: png.BestCompression, Colors: c.OutputImage.PNGColors})
+	}
+
+	// Add the paletted outputs with fewer colors than the given ones.
+	for _, colors := range []int{256, 128, 64, 32, 16} {
+		if c.OutputImage.PNGColors == 0 || colors < c.OutputImage.PNGColors {
+			settings = append(settings, pngSettings{Compression: png.BestCompression, Colors: colors})
+		}
+	}
+
+	// Create a buffer to store the smallest encoded image.
+	var smallest *bytes.Buffer
+
+	// Try the settings until the encoded image fits under the size budget.
+	for _, s := range settings {
+		// Encode the image to the buffer with the current settings.
+		buf := &bytes.Buffer{}
+		if err := encodePNGWithSettings(buf, img, s); err != nil {
+			return err
+		}
+
+		// Write the encoded image, if it fits under the size budget.
+		if buf.Len() <= c.OutputImage.PNGMaxSize*1024 {
+			_, err := buf.WriteTo(w)
+			return err
+		}
+
+		// Save the encoded image, if it is the smallest one.
+		if smallest == nil || buf.Len() < smallest.Len() {
+			smallest = buf
+		}
+	}
+
+	slog.Warn(
+		"output image does not fit under the size budget",
+		"size_kb", smallest.Len()/1024, "budget_kb", c.OutputImage.PNGMaxSize,
+	)
+
+	// Write the smallest encoded image.
+	_, err := smallest.WriteTo(w)
+
+	return err
+}
+
+// encodePNGWithSettings encodes the given image to the given writer in the PNG
+// format with the given settings of the PNG encoder.
+func encodePNGWithSettings(w io.Writer, img image.Image, settings pngSettings) error {
+	// Quantize the image to the paletted one, if the number of colors is set.
+	if settings.Colors > 0 {
+		img = makeImagePaletted(img, settings.Colors)
+	}
+
+	// Create a new PNG encoder with the compression level.
+	encoder := &png.Encoder{CompressionLevel: settings.Compression}
+
+	return encoder.Encode(w, img)
+}
+
+// encodeNegotiateFormat selects the output image format among the given
+// allowed formats by the given value of the Accept header. The quality value
+// of each format is set by its most specific media range (RFC 9110), so the
+// "image/png;q=0" excludes PNG even with the "image/*" range. It returns the
+// accepted format with the highest quality value (the explicitly accepted one
+// before the one accepted by a wildcard), and the default one ("png", or the
+// first allowed format, if PNG is not allowed) if no allowed format is
+// accepted.
+func encodeNegotiateFormat(accept string, allowed []string) string {
+	// Set the default format.
+	fallback := "png"
+	if !slices.Contains(allowed, fallback) && len(allowed) > 0 {
+		fallback = allowed[0]
+	}
+	format, quality, rank := fallback, 0.0, 0
+
+	// Iterate over the formats in the order of preference.
+	for _, f := range imageFormatsOrder {
+		// Skip the format, if it is not allowed.
+		if !slices.Contains(allowed, f) {
+			continue
+		}
+
+		// Find the quality value of the format by its most specific media range.
+		q, specificity := encodeAcceptQuality(accept, imageContentTypes[f])
+
+		// Rank the format to break the ties of the quality values: the explicitly accepted format first, then the
+		// default format accepted by a wildcard, then the others in the order of preference.
+		r := 0
+		if specificity == 2 {
+			r = 2
+		} else if f == fallback {
+			r = 1
+		}
+
+		// Select the format, if it is accepted with the highest quality value (the q=0 means "not acceptable").
+		if q > 0 && (q > quality || (q == quality && r > rank)) {
+			format, quality, rank = f, q, r
+		}
+	}
+
+	return format
+}
+
+// encodeAcceptQuality returns the quality value of the given content type by
+// the most specific media range of the given Accept header, which matches it,
+// and the specificity of the range (2 for the exact type, 1 for "image/*", 0
+// for "*/*"). The quality value is 0, if no media range matches.
+func encodeAcceptQuality(accept, contentType string) (float64, int) {
+	quality, specificity := 0.0, -1
+
+	// Iterate over the media ranges of the Accept header.
+	for _, mediaRange := range strings.Split(accept, ",") {
+		// Split the media range into the media type and parameters.
+		params := strings.Split(mediaRange, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+
+		// Find the specificity of the media type, and skip it, if it does not match the content type or a more
+		// specific one is already found.
+		s := -1
+		switch {
+		case mediaType == contentType:
+			s = 2
+		case mediaType == "image/*":
+			s = 1
+		case mediaType == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+
+		// Parse the quality value of the media type (1.0 by default).
+		q := 1.0
+		for _, param := range params[1:] {
+			if value, ok := strings.CutPrefix(strings.ToLower(strings.TrimSpace(param)), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		quality, specificity = q, s
+	}
+
+	return quality, specificity
+}
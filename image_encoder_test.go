@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestEncodeNegotiateFormat(t *testing.T) {
+	all := []string{"png", "webp", "jpeg"}
+
+	tests := []struct {
+		name, accept string
+		allowed      []string
+		want         string
+	}{
+		{"empty", "", all, "png"},
+		{"any", "*/*", all, "png"},
+		{"any image", "image/*", all, "png"},
+		{"browser", "image/avif,image/webp,image/apng,image/*,*/*;q=0.8", all, "webp"},
+		{"explicit jpeg", "image/jpeg", all, "jpeg"},
+		{"higher quality", "image/webp;q=0.5, image/jpeg;q=0.9", all, "jpeg"},
+		{"explicit before wildcard", "image/jpeg, image/*", all, "jpeg"},
+		{"excluded by specific type", "image/png;q=0, image/*", all, "webp"},
+		{"excluded under any", "image/png;q=0, */*", all, "webp"},
+		{"specific lower than wildcard", "image/png;q=0.1, image/*;q=0.9", all, "webp"},
+		{"wildcard lower than any", "image/*;q=0, */*", all, "png"},
+		{"all excluded", "image/*;q=0", all, "png"},
+		{"not allowed", "image/webp", []string{"png", "jpeg"}, "png"},
+		{"png not allowed", "*/*", []string{"jpeg", "webp"}, "jpeg"},
+		{"case insensitive", "Image/WEBP;Q=1", all, "webp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeNegotiateFormat(tt.accept, tt.allowed); got != tt.want {
+				t.Errorf("encodeNegotiateFormat(%q, %v) = %q, want %q", tt.accept, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,9 +3,13 @@ package main
 import (
 	"image"
 	"image/color"
+	"image/draw"
+	"sort"
 
 	"github.com/disintegration/imaging"
 	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
 )
 
 // makeImageResize resizes the given image to the specified width and height.
@@ -70,3 +74,128 @@ func makeImageRounded(img image.Image, radius float64) image.Image {
 
 	return ctx.Image()
 }
+
+// makeImageLabel draws the given text with the given font face and color on
+// the given image, in the box with the given top-left corner and width (the
+// text is centered in the box, if needed). The text, which does not fit the
+// box, is truncated with the ellipsis.
+func makeImageLabel(img *image.NRGBA, face font.Face, text string, x, y, width int, center bool, c color.NRGBA) {
+	// Truncate the text to fit the width of the box.
+	text = makeLabelText(face, text, width)
+
+	// Calculate the position of the text in the box (the dot is on the baseline).
+	offsetX := fixed.I(x)
+	if center {
+		offsetX += (fixed.I(width) - font.MeasureString(face, text)) / 2
+	}
+
+	// Draw the text onto the image.
+	drawer := &font.Drawer{
+		Dst: img, Src: image.NewUniform(c), Face: face,
+		Dot: fixed.Point26_6{X: offsetX, Y: fixed.I(y) + face.Metrics().Ascent},
+	}
+	drawer.DrawString(text)
+}
+
+// makeLabelText returns the given text, which fits the given width with the
+// given font face: the text itself, or its longest prefix with the ellipsis.
+func makeLabelText(face font.Face, text string, width int) string {
+	// Return the text, if it fits the width.
+	if font.MeasureString(face, text) <= fixed.I(width) {
+		return text
+	}
+
+	// Remove the last characters of the text until it fits the width with the ellipsis.
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if truncated := string(runes) + "…"; font.MeasureString(face, truncated) <= fixed.I(width) {
+			return truncated
+		}
+	}
+
+	return ""
+}
+
+// makeImagePaletted quantizes an input image to the paletted image with the
+// given number of colors and returns the paletted image.
+//
+// The palette is made by the popularity of the colors (grouped by the 4 most
+// significant bits of each channel), with one fully transparent color always
+// reserved. The image is drawn onto the palette with Floyd–Steinberg dithering.
+func makeImagePaletted(img image.Image, colors int) *image.Paletted {
+	// Get the bounds of the input image.
+	bounds := img.Bounds()
+
+	// Create a map to count the colors of the input image by their groups.
+	type colorGroup struct {
+		R, G, B, A, Count int
+	}
+	groups := make(map[uint16]*colorGroup)
+
+	// Count the colors of the input image (except the fully transparent ones).
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+
+			// Calculate the key of the color group.
+			key := uint16(c.R>>4)<<12 | uint16(c.G>>4)<<8 | uint16(c.B>>4)<<4 | uint16(c.A>>4)
+
+			// Add the color to the group.
+			group, ok := groups[key]
+			if !ok {
+				group = &colorGroup{}
+				groups[key] = group
+			}
+			group.R, group.G, group.B, group.A = group.R+int(c.R), group.G+int(c.G), group.B+int(c.B), group.A+int(c.A)
+			group.Count++
+		}
+	}
+
+	// Sort the color groups by their popularity.
+	sorted := make([]*colorGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Count > sorted[j].Count })
+
+	// Create a palette with the fully transparent color and the average colors of the most popular groups.
+	palette := color.Palette{color.NRGBA{}}
+	for _, group := range sorted[:min(len(sorted), colors-1)] {
+		palette = append(palette, color.NRGBA{
+			R: uint8(group.R / group.Count), G: uint8(group.G / group.Count),
+			B: uint8(group.B / group.Count), A: uint8(group.A / group.Count),
+		})
+	}
+
+	// Create a new paletted image and draw the input image onto it with dithering.
+	palettedImg := image.NewPaletted(bounds, palette)
+	draw.FloydSteinberg.Draw(palettedImg, bounds, img, bounds.Min)
+
+	return palettedImg
+}
+
+// makeImagePlaceholder makes a placeholder image (one light gray avatar with
+// the given shape, size and radius), which is shown while the repository is
+// not fetched yet.
+func makeImagePlaceholder(o renderOptions) image.Image {
+	// Set the sizes of the placeholder with the scale factor.
+	o = o.scaled()
+
+	// Create a new image filled with the light gray color.
+	img := imaging.New(o.Size, o.Size, color.NRGBA{R: 225, G: 228, B: 232, A: 255})
+
+	switch o.Shape {
+	case "rounded":
+		// Round the image.
+		return makeImageRounded(img, o.RoundedRadius)
+	case "circular":
+		// Circular the image.
+		return makeImageCircular(img)
+	}
+
+	return img
+}
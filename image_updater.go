@@ -1,47 +1,408 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"image"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// updateFinalImage is a function that runs in a separate goroutine and updates
-// the finalImage variable every N seconds.
-func (c *Config) updateFinalImage(stargazers, contributors *image.NRGBA) {
-	for {
-		// Sleep for updateInterval seconds before updating again.
-		time.Sleep(time.Duration(c.OutputImage.UpdateInterval) * time.Second)
+// Stats is a struct that represents the current statistics of the repository:
+// the users with their avatar images, the users of each named image (filtered
+// and ordered by its definition) and the final images rendered from them, with
+// the last error, the time of the next scheduled refresh (and of the last
+// signed webhook of each source), the history of the changes of the users
+// (with the names of the notifiers, which were configured, when it was
+// notified last time), the star history and the lost stargazers.
+type Stats struct {
+	mu          sync.RWMutex
+	Repository  *repository
+	Store       ImageStore
+	Avatars     map[string][]UserAvatar
+	Images      map[string]*image.NRGBA
+	UpdatedAt   time.Time
+	LastError   string
+	LastErrorAt time.Time
+	NextRefresh time.Time
+	LastWebhook map[string]time.Time
+	History     []historyEvent
+	Notifiers   []string
+	Stars       starTimeline
+	Lost        []lostStargazer
+	encoded     *lruCache
+	flights     *flightGroup
+	notifying   sync.Mutex
+	backfilling atomic.Bool
+}
 
-		// Fetch stargazers' image URLs.
-		images, err := c.fetchImages()
-		if err != nil {
-			slog.Error("failed to download image", "details", err.Error())
-			// Sleep for the update interval seconds before trying again.
-			time.Sleep(time.Duration(c.OutputImage.UpdateInterval) * time.Second)
-			continue
+// newStats creates a new empty Stats for the given repository with the bounded
+// cache of the encoded images of the given size.
+func newStats(repo *repository, cacheSize int) *Stats {
+	return &Stats{
+		Repository:  repo,
+		Avatars:     make(map[string][]UserAvatar),
+		Images:      make(map[string]*image.NRGBA),
+		LastWebhook: make(map[string]time.Time),
+		Stars:       newStarTimeline(),
+		Lost:        make([]lostStargazer, 0),
+		encoded:     newLRUCache(cacheSize),
+		flights:     newFlightGroup(),
+	}
+}
+
+// set replaces the current statistics with the given ones.
+func (s *Stats) set(store ImageStore, avatars map[string][]UserAvatar, images map[string]*image.NRGBA) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Store, s.Avatars, s.Images, s.UpdatedAt = store, avatars, images, time.Now()
+	s.encoded.purge()
+}
+
+// setUpdatedAt sets the time of the last update of the stats (e.g., the time
+// of the restored snapshot), and purges the cache of the encoded images.
+func (s *Stats) setUpdatedAt(updatedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.UpdatedAt = updatedAt
+	s.encoded.purge()
+}
+
+// setError remembers the given error of the last failed update of the stats.
+func (s *Stats) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastError, s.LastErrorAt = err.Error(), time.Now()
+}
+
+// setNextRefresh sets the time of the next scheduled update of the stats.
+func (s *Stats) setNextRefresh(next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.NextRefresh = next
+}
+
+// setLastWebhook remembers the time of the last signed webhook, which
+// scheduled the refresh of the given source of the repository of the stats.
+func (s *Stats) setLastWebhook(source string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastWebhook[source] = at
+}
+
+// lastWebhook returns the time of the last signed webhook, which scheduled the
+// refresh of the given source of the repository of the stats (the zero time,
+// if no webhooks arrived).
+func (s *Stats) lastWebhook(source string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.LastWebhook[source]
+}
+
+// health returns the last error (with its time) and the time of the next
+// scheduled update of the stats.
+func (s *Stats) health() (lastError string, lastErrorAt, nextRefresh time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.LastError, s.LastErrorAt, s.NextRefresh
+}
+
+// repository returns the current repository of the stats.
+func (s *Stats) repository() *repository {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.Repository
+}
+
+// store returns the current store of the avatar images of the stats.
+func (s *Stats) store() ImageStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.Store
+}
+
+// setRepository replaces the repository of the stats (e.g., after the reload
+// of the configuration). The users and the final images are not changed.
+func (s *Stats) setRepository(repo *repository) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Repository = repo
+}
+
+// avatars returns the current users of the image with the given name.
+func (s *Stats) avatars(name string) []UserAvatar {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.Avatars[name]
+}
+
+// encodedImage returns the final image with the given name rendered with the
+// given options and encoded in the given format.
+//
+// The final image with the options from its definition is already rendered by
+// the update of the stats. Any other variant (e.g., with the 2x or 3x scale,
+// or with the custom options from the query parameters) is rendered on demand
+// from the cached original-resolution avatars.
+//
+// The encoded images are kept in the bounded LRU cache until the next update
+// of the stats, and the concurrent requests for the same variant are coalesced
+// into one in-flight render, so each variant is usually rendered and encoded
+// only once.
+func (c *Config) encodedImage(s *Stats, def *imageDefinition, format string, o renderOptions) ([]byte, error) {
+	// Get the current users and the final image with the given name.
+	s.mu.RLock()
+	avatars, finalImage := s.Avatars[def.Name], s.Images[def.Name]
+	updatedAt := s.UpdatedAt
+	s.mu.RUnlock()
+
+	// Create a key for the cache of the encoded images.
+	key := encodedKey(def.Name, format, updatedAt, o)
+
+	// Return the cached encoded image, if it exists.
+	if encoded, ok := s.encoded.get(key); ok {
+		metricCacheRequests.inc("hit")
+		return encoded, nil
+	}
+	metricCacheRequests.inc("miss")
+
+	// Render and encode the final image in the in-flight call (or join the existing one for the same variant).
+	call := s.flights.do(key, func() (any, error) {
+		// Render the final image with the given options, if they are not the ones from the definition.
+		if o != def.Options || finalImage == nil {
+			// Wait for a free slot of the on-demand renders.
+			renderSlots <- struct{}{}
+			defer func() { <-renderSlots }()
+
+			renderedImage, err := prepareFinalImage(avatars, o)
+			if err != nil {
+				return nil, err
+			}
+			finalImage = renderedImage
 		}
 
-		// Call prepareFinalImage with the required parameters for stargazers.
-		stargazersFinalImage, err := c.prepareFinalImage(images.Stargazers)
-		if err != nil {
-			slog.Error("failed to prepare the final image for stargazers", "details", err.Error())
-			return
+		// Encode the final image in the given format.
+		var buf bytes.Buffer
+		if err := c.encodeImage(&buf, finalImage, format); err != nil {
+			return nil, err
+		}
+
+		// Save the encoded image to the cache.
+		s.encoded.add(key, buf.Bytes())
+
+		return buf.Bytes(), nil
+	})
+
+	// Wait for the result of the in-flight call.
+	encoded, err := call.wait(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return encoded.([]byte), nil
+}
+
+// encodedKey returns the key of the encoded image with the given name, format
+// and render options in the cache, for the given time of the update of the
+// stats (so the images of the previous updates are never mixed up).
+func encodedKey(name, format string, updatedAt time.Time, o renderOptions) string {
+	return fmt.Sprintf("%s.%s.%d.%+v", name, format, updatedAt.UnixNano(), o)
+}
+
+// lastUpdate returns the time of the last successful update of the stats.
+func (s *Stats) lastUpdate() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.UpdatedAt
+}
+
+// updateStats fetches the avatar images of the repository and prepares the
+// final images by the definitions of its images, then saves them to the given
+// stats.
+func (c *Config) updateStats(stats *Stats) error {
+	return c.updateStatsImages(stats, stats.repository().Images)
+}
+
+// updateStatsImages fetches the avatar images of the sources of the given
+// images of the repository only (e.g., for the forced refresh of one image),
+// and prepares all final images with them and the cached users of the other
+// sources, then saves them to the given stats.
+func (c *Config) updateStatsImages(stats *Stats, images []*imageDefinition) error {
+	// Hold the shared lock while updating, so the shutdown waits for the running update before saving the state.
+	shutdownUpdates.RLock()
+	defer shutdownUpdates.RUnlock()
+
+	// Fetch the stargazers and contributors used by the given images.
+	start := time.Now()
+	repo := stats.repository()
+	fetched := &repository{Owner: repo.Owner, Name: repo.Name, Images: images}
+	store, err := c.fetchUsersStore(fetched)
+	if err != nil {
+		stats.setError(err)
+		updateMetrics(fetched, start, "failure")
+		return err
+	}
+
+	// Keep the cached users of the sources, which are used by the repository, but not fetched.
+	cached := stats.store()
+	if !fetched.usesSource("stargazers") && repo.usesSource("stargazers") {
+		store.Stargazers, store.StargazersComplete = cached.Stargazers, cached.StargazersComplete
+	}
+	if !fetched.usesSource("contributors") && repo.usesSource("contributors") {
+		store.Contributors, store.ContributorsComplete = cached.Contributors, cached.ContributorsComplete
+	}
+
+	// Set the avatar images of the users, who will be rendered by any image of the repository (the same avatars are
+	// taken from the cached users, and only the new ones are downloaded).
+	store = c.prepareStoreImages(repo, store, cached)
+
+	// Compare the fetched users with the previous ones (if they exist) to find the new and lost users.
+	event, changed := makeHistoryEvent(fetched, cached, store)
+	lastSeenAt := stats.lastUpdate()
+	changed = changed && !lastSeenAt.IsZero()
+
+	// Add the fetched stargazers to the star history (before the final images, which replace the cached charts).
+	if fetched.usesSource("stargazers") {
+		c.updateStarTimeline(stats, store.Stargazers)
+	}
+
+	// Prepare the final images from the fetched avatar images.
+	if err := c.renderStats(stats, store); err != nil {
+		stats.setError(err)
+		updateMetrics(fetched, start, "failure")
+		return err
+	}
+	updateMetrics(fetched, start, "success")
+
+	// Add the changes of the users to the history.
+	if changed {
+		stats.addHistory(event)
+	}
+
+	// Remember the lost stargazers (the unstars), only if both lists of the stargazers are complete, so the users cut
+	// off by the max number of pages are never counted by the churn and the metric.
+	if changed && historyComparable(fetched, cached, store, "stargazers") {
+		stats.addLost(event, lastSeenAt)
+		for range event.LostStargazers {
+			metricLostStargazers.inc(fetched.String())
 		}
+	}
+
+	// Persist the successful update to the state directory, if it is set.
+	if err := c.stateSave(stats); err != nil {
+		slog.Error("failed to save state", "repository", stats.repository().String(), "details", err.Error())
+	}
 
-		// Call prepareFinalImage with the required parameters for contributors.
-		contributorsFinalImage, err := c.prepareFinalImage(images.Contributors)
+	// Send the notifications about the changes, which are not delivered yet (in the background, so the slow sinks
+	// do not delay the refresh and the shutdown).
+	go c.notifyHistory(stats)
+
+	slog.Info(
+		"successfully collected avatar images",
+		"repository", stats.repository().String(),
+		"stargazers", len(store.Stargazers), "contributors", len(store.Contributors),
+	)
+
+	return nil
+}
+
+// updateMetrics counts the refresh of each (refreshed) image of the given
+// repository with the given outcome, and observes its duration since the given
+// start time.
+func updateMetrics(repo *repository, start time.Time, outcome string) {
+	duration := time.Since(start).Seconds()
+	for _, def := range repo.Images {
+		metricRefreshes.inc(repo.String(), def.Name, outcome)
+		metricRefreshDuration.observe(duration, repo.String(), def.Name)
+	}
+}
+
+// renderStats prepares the final images from the given store of the avatar
+// images by the definitions of the images of the repository, then saves them
+// to the given stats. It does not fetch anything, so it is used to re-render
+// the final images from the cached avatars.
+func (c *Config) renderStats(stats *Stats, store ImageStore) error {
+	// Get the current repository of the stats.
+	repo := stats.repository()
+
+	// Create maps to store the users and the final images by the names of the images.
+	avatars := make(map[string][]UserAvatar, len(repo.Images))
+	images := make(map[string]*image.NRGBA, len(repo.Images))
+
+	for _, def := range repo.Images {
+		// Filter and order the users of the image by its definition.
+		avatars[def.Name] = prepareImageAvatars(store.bySource(def.Source), def)
+
+		// Call prepareFinalImage with the render options of the image.
+		finalImage, err := prepareFinalImage(avatars[def.Name], def.Options)
 		if err != nil {
-			slog.Error("failed to prepare the final image for contributors", "details", err.Error())
+			return err
+		}
+		images[def.Name] = finalImage
+	}
+
+	// Update the stats with the new images.
+	stats.set(store, avatars, images)
+
+	return nil
+}
+
+// updateFinalImage is a function that runs in a separate goroutine and updates
+// the given stats every N seconds (by the refresh interval of the repository),
+// until the stop channel is closed.
+//
+// While the signed webhooks of a source arrive, the images of the source are
+// already refreshed by them, so the source is not polled. The polling of the
+// source is restored, if no webhooks of the source arrive for the
+// webhookQuietPeriod.
+func (c *Config) updateFinalImage(stats *Stats, stop <-chan struct{}) {
+	// Create a new ticker with the refresh interval.
+	interval := time.Duration(stats.repository().RefreshInterval) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Set the time of the next refresh.
+		stats.setNextRefresh(time.Now().Add(interval))
+
+		// Wait for the refresh interval or the stop signal.
+		select {
+		case <-stop:
 			return
+		case <-ticker.C:
 		}
 
-		// Update the final images variable with the new image.
-		*stargazers, *contributors = *stargazersFinalImage, *contributorsFinalImage
+		// Select the images of the sources, which got no webhooks within the quiet period.
+		images := make([]*imageDefinition, 0)
+		for _, def := range stats.repository().Images {
+			if time.Since(stats.lastWebhook(def.Source)) >= webhookQuietPeriod {
+				images = append(images, def)
+			}
+		}
+
+		// Skip the polling, if the webhooks of all sources arrive.
+		if len(images) == 0 {
+			slog.Debug("skipped polling, the webhooks arrive", "repository", stats.repository().String())
+			continue
+		}
 
-		slog.Info(
-			"successfully updated final images",
-			"stargazers", len(images.Stargazers), "contributors", len(images.Contributors),
-		)
+		// Fetch the avatar images of the selected sources and prepare the final images.
+		if err := c.updateStatsImages(stats, images); err != nil {
+			slog.Error("failed to update final images", "repository", stats.repository().String(), "details", err.Error())
+			continue
+		}
 	}
 }
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileSettings is a map of the settings from the configuration file by
+// the names of the environment variables (e.g., "AVATAR_SHAPE"). It is used by
+// the helpGetEnv function as the defaults for the environment variables.
+var configFileSettings = map[string]string{}
+
+// fileConfig represents the part of the configuration file with the declared
+// repositories. All other settings of the file are flattened to the names of
+// the environment variables (e.g., "avatar.shape" to "AVATAR_SHAPE").
+type fileConfig struct {
+	Repositories []fileRepository `yaml:"repositories" toml:"repositories"`
+}
+
+// fileRepository represents the repository declared in the configuration file.
+type fileRepository struct {
+	Owner           string      `yaml:"owner" toml:"owner"`
+	Name            string      `yaml:"name" toml:"name"`
+	RefreshInterval int         `yaml:"refresh_interval" toml:"refresh_interval"`
+	Images          []fileImage `yaml:"images" toml:"images"`
+}
+
+// fileImage represents the named image of the repository declared in the
+// configuration file. The unset layout options are taken from the avatar and
+// output image settings.
+type fileImage struct {
+	Name    string   `yaml:"name" toml:"name"`
+	Source  string   `yaml:"source" toml:"source"`
+	Order   string   `yaml:"order" toml:"order"`
+	Shape   string   `yaml:"shape" toml:"shape"`
+	Label   string   `yaml:"label" toml:"label"`
+	Formats []string `yaml:"formats" toml:"formats"`
+	Filters struct {
+		Exclude          []string `yaml:"exclude" toml:"exclude"`
+		ExcludeBots      bool     `yaml:"exclude_bots" toml:"exclude_bots"`
+		MinContributions int      `yaml:"min_contributions" toml:"min_contributions"`
+	} `yaml:"filters" toml:"filters"`
+	Layout struct {
+		Size             *int     `yaml:"size" toml:"size"`
+		HorizontalMargin *int     `yaml:"horizontal_margin" toml:"horizontal_margin"`
+		VerticalMargin   *int     `yaml:"vertical_margin" toml:"vertical_margin"`
+		RoundedRadius    *float64 `yaml:"rounded_radius" toml:"rounded_radius"`
+		MaxPerRow        *int     `yaml:"max_per_row" toml:"max_per_row"`
+		MaxRows          *int     `yaml:"max_rows" toml:"max_rows"`
+		LabelSize        *int     `yaml:"label_size" toml:"label_size"`
+		LabelWidth       *int     `yaml:"label_width" toml:"label_width"`
+	} `yaml:"layout" toml:"layout"`
+}
+
+// loadConfigFile loads the configuration file (YAML or TOML, by the extension)
+// from the given path, and returns the declared repositories. If the path is
+// empty, no file is loaded.
+//
+// All other settings of the file are saved to the configFileSettings map by
+// the names of the environment variables.
+func loadConfigFile(path string) ([]fileRepository, error) {
+	// Reset the settings from the previous configuration file.
+	configFileSettings = map[string]string{}
+
+	// Return no repositories, if the path is not set.
+	if path == "" {
+		return nil, nil
+	}
+
+	// Read the configuration file.
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a map for all settings and a struct for the repositories.
+	settings := make(map[string]any)
+	config := fileConfig{}
+
+	// Decode the configuration file by its extension.
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("failed to decode configuration file %s (%s)", path, err.Error())
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to decode configuration file %s (%s)", path, err.Error())
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("failed to decode configuration file %s (%s)", path, err.Error())
+		}
+		if err := toml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to decode configuration file %s (%s)", path, err.Error())
+		}
+	default:
+		return nil, fmt.Errorf("unknown extension '%s' of configuration file (must be .yaml, .yml or .toml)", ext)
+	}
+
+	// Flatten all settings (except the repositories) to the names of the environment variables.
+	delete(settings, "repositories")
+	loadFlatten("", settings, configFileSettings)
+
+	return config.Repositories, nil
+}
+
+// loadFlatten flattens the given value of the configuration file to the given
+// map by the names of the environment variables. The keys of the nested maps
+// are joined with the underscore, and the lists are joined with the comma.
+func loadFlatten(prefix string, value any, settings map[string]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		// Flatten each item of the map with the key as the prefix.
+		for key, item := range v {
+			name := strings.ToUpper(key)
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			loadFlatten(name, item, settings)
+		}
+	case []any:
+		// Join the items of the list with the comma.
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		settings[prefix] = strings.Join(items, ",")
+	default:
+		settings[prefix] = fmt.Sprint(v)
+	}
+}
+
+// loadRepositories creates the repositories from the given repositories of the
+// configuration file. The unset values are taken from the default repository
+// and the default render options. The problems of the repositories are added
+// to the given validator with the keys of the configuration file (e.g.,
+// "repositories[0].images[1].order").
+func (c *Config) loadRepositories(fileRepositories []fileRepository, v *configValidator) []*repository {
+	// Create a slice to store the repositories.
+	repos := make([]*repository, 0, len(fileRepositories))
+
+	for i, fileRepo := range fileRepositories {
+		// Create a key of the repository in the configuration file.
+		key := fmt.Sprintf("repositories[%d]", i)
+
+		// Create a new repository with the default refresh interval and images.
+		repo := &repository{
+			Owner:           fileRepo.Owner,
+			Name:            fileRepo.Name,
+			RefreshInterval: c.Repository.RefreshInterval,
+			Images:          c.defaultImages(),
+		}
+
+		// Check, if the owner and name of the repository are set.
+		v.check(repo.Owner != "", key+".owner", repo.Owner, "a non-empty string")
+		v.check(repo.Name != "", key+".name", repo.Name, "a non-empty string")
+
+		// Set the refresh interval of the repository, if it exists.
+		if fileRepo.RefreshInterval != 0 {
+			repo.RefreshInterval = fileRepo.RefreshInterval
+			v.check(
+				repo.RefreshInterval >= c.minUpdateInterval(), key+".refresh_interval",
+				strconv.Itoa(repo.RefreshInterval), describeRange(c.minUpdateInterval(), math.MaxInt),
+			)
+		}
+
+		// Set the images of the repository, if they exist.
+		if len(fileRepo.Images) > 0 {
+			repo.Images = make([]*imageDefinition, 0, len(fileRepo.Images))
+			for j, fileImg := range fileRepo.Images {
+				// Create a key of the image in the configuration file.
+				imageKey := fmt.Sprintf("%s.images[%d]", key, j)
+
+				// Check, if the name of the image is set and unique.
+				v.check(fileImg.Name != "", imageKey+".name", fileImg.Name, "a non-empty string")
+				v.check(
+					fileImg.Name == "" || repo.image(fileImg.Name) == nil, imageKey+".name", fileImg.Name,
+					"unique for the repository",
+				)
+
+				repo.Images = append(repo.Images, c.loadImage(fileImg, imageKey, v))
+			}
+		}
+
+		repos = append(repos, repo)
+	}
+
+	return repos
+}
+
+// loadImage creates the definition of the image from the given image of the
+// configuration file. The unset values are taken from the default ones. The
+// problems of the image are added to the given validator with the given key
+// of the image in the configuration file.
+func (c *Config) loadImage(fileImg fileImage, key string, v *configValidator) *imageDefinition {
+	// Create a new definition with the default values.
+	def := &imageDefinition{
+		Name:    fileImg.Name,
+		Source:  fileImg.Source,
+		Order:   fileImg.Order,
+		Options: c.defaultRenderOptions(),
+		Formats: fileImg.Formats,
+		Filters: imageFilters{
+			Exclude:          fileImg.Filters.Exclude,
+			ExcludeBots:      fileImg.Filters.ExcludeBots,
+			MinContributions: fileImg.Filters.MinContributions,
+		},
+	}
+
+	// Set the source by the name of the image, and the default order and formats, if they are not set.
+	if def.Source == "" {
+		def.Source = def.Name
+	}
+	if def.Order == "" {
+		def.Order = "default"
+	}
+	if len(def.Formats) == 0 {
+		def.Formats = []string{"png", "webp", "jpeg"}
+	}
+	for i, format := range def.Formats {
+		if format == "jpg" {
+			def.Formats[i] = "jpeg"
+		}
+	}
+
+	// Check the source, order, formats and filters of the image.
+	v.check(
+		def.Source == "stargazers" || def.Source == "contributors", key+".source", def.Source,
+		"one of: stargazers, contributors",
+	)
+	v.check(
+		slices.Contains([]string{"default", "newest", "oldest", "login", "contributions"}, def.Order), key+".order",
+		def.Order, "one of: default, newest, oldest, login, contributions",
+	)
+	for i, format := range def.Formats {
+		v.check(
+			format == "png" || format == "webp" || format == "jpeg", fmt.Sprintf("%s.formats[%d]", key, i), format,
+			"one of: png, webp, jpeg, jpg",
+		)
+	}
+	for i, pattern := range def.Filters.Exclude {
+		_, err := path.Match(pattern, "")
+		v.check(err == nil, fmt.Sprintf("%s.filters.exclude[%d]", key, i), pattern, "a valid glob pattern")
+	}
+	v.check(
+		def.Filters.MinContributions >= 0, key+".filters.min_contributions",
+		strconv.Itoa(def.Filters.MinContributions), describeRange(0, math.MaxInt),
+	)
+
+	// Set the shape of the image, if it exists.
+	if fileImg.Shape != "" {
+		def.Options.Shape = fileImg.Shape
+		v.check(
+			slices.Contains([]string{"rounded", "circular", "square"}, def.Options.Shape), key+".shape",
+			def.Options.Shape, "one of: rounded, circular, square",
+		)
+	}
+
+	// Set the position of the labels of the image, if it exists.
+	if fileImg.Label != "" {
+		def.Options.Label = fileImg.Label
+		v.check(
+			slices.Contains([]string{"none", "below", "beside"}, def.Options.Label), key+".label",
+			def.Options.Label, "one of: none, below, beside",
+		)
+	}
+
+	// Set the layout options with their bounds, if they exist.
+	for _, option := range []struct {
+		name     string
+		min, max int
+		value    *int
+		target   *int
+	}{
+		{"size", 16, 256, fileImg.Layout.Size, &def.Options.Size},
+		{"horizontal_margin", 0, 64, fileImg.Layout.HorizontalMargin, &def.Options.HorizontalMargin},
+		{"vertical_margin", 0, 64, fileImg.Layout.VerticalMargin, &def.Options.VerticalMargin},
+		{"max_per_row", 1, 32, fileImg.Layout.MaxPerRow, &def.Options.MaxPerRow},
+		{"max_rows", 1, 16, fileImg.Layout.MaxRows, &def.Options.MaxRows},
+		{"label_size", 6, 48, fileImg.Layout.LabelSize, &def.Options.LabelSize},
+		{"label_width", 16, 256, fileImg.Layout.LabelWidth, &def.Options.LabelWidth},
+	} {
+		if option.value != nil {
+			*option.target = *option.value
+			v.check(
+				*option.value >= option.min && *option.value <= option.max, key+".layout."+option.name,
+				strconv.Itoa(*option.value), describeRange(option.min, option.max),
+			)
+		}
+	}
+
+	// Set the radius of the corners, if it exists, or limit the default one by the size.
+	if fileImg.Layout.RoundedRadius != nil {
+		def.Options.RoundedRadius = *fileImg.Layout.RoundedRadius
+		v.check(
+			def.Options.RoundedRadius >= 0 && def.Options.RoundedRadius <= float64(def.Options.Size)/2,
+			key+".layout.rounded_radius", strconv.FormatFloat(def.Options.RoundedRadius, 'g', -1, 64),
+			fmt.Sprintf("a number from 0 to %g", float64(def.Options.Size)/2),
+		)
+	} else {
+		def.Options.RoundedRadius = min(def.Options.RoundedRadius, float64(def.Options.Size)/2)
+	}
+
+	return def
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// lostStargazersFile is the name of the file with the lost stargazers in the
+// state directory of the repository.
+const lostStargazersFile = "lost-stargazers.json"
+
+// lostStargazersMax is the max number of the lost stargazers kept for each
+// repository (the oldest ones are dropped first).
+const lostStargazersMax = 1000
+
+// lostStargazer represents the user, who unstarred the repository. The unstar
+// happened between the last refresh, which saw the user (LastSeenAt), and the
+// refresh, which did not see the user anymore (UnstarredAt).
+type lostStargazer struct {
+	Login       string     `json:"login"`
+	AvatarURL   string     `json:"avatar_url"`
+	ProfileURL  string     `json:"profile_url"`
+	StarredAt   *time.Time `json:"starred_at,omitempty"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	UnstarredAt time.Time  `json:"unstarred_at"`
+}
+
+// addLost adds the lost stargazers of the given event to the stats (the users
+// were last seen at the given time), and drops the oldest ones over the
+// lostStargazersMax.
+func (s *Stats) addLost(event historyEvent, lastSeenAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range event.LostStargazers {
+		s.Lost = append(s.Lost, lostStargazer{
+			Login:       user.Login,
+			AvatarURL:   user.AvatarURL,
+			ProfileURL:  user.ProfileURL,
+			StarredAt:   user.StarredAt,
+			LastSeenAt:  lastSeenAt.UTC(),
+			UnstarredAt: event.CreatedAt,
+		})
+	}
+	if len(s.Lost) > lostStargazersMax {
+		s.Lost = slices.Clone(s.Lost[len(s.Lost)-lostStargazersMax:])
+	}
+}
+
+// lostStargazers returns a copy of the lost stargazers of the stats (from the
+// oldest unstar to the newest one).
+func (s *Stats) lostStargazers() []lostStargazer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.Lost)
+}
+
+// setLostStargazers replaces the lost stargazers of the stats (e.g., with the
+// restored ones).
+func (s *Stats) setLostStargazers(lost []lostStargazer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Lost = lost
+}
+
+// writeLostStargazers writes the given lost stargazers to the given directory.
+func writeLostStargazers(dir string, lost []lostStargazer) error {
+	data, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalIndent(lost, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, lostStargazersFile), data, 0o644)
+}
+
+// readLostStargazers reads the lost stargazers from the given directory. It
+// returns no lost stargazers, if the file does not exist.
+func readLostStargazers(dir string) ([]lostStargazer, error) {
+	lost := make([]lostStargazer, 0)
+
+	// Read the file of the lost stargazers, if it exists.
+	data, err := os.ReadFile(filepath.Join(dir, lostStargazersFile))
+	if os.IsNotExist(err) {
+		return lost, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the lost stargazers.
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, &lost); err != nil {
+		return nil, fmt.Errorf("failed to decode %s (%s)", lostStargazersFile, err.Error())
+	}
+
+	return lost, nil
+}
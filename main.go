@@ -2,14 +2,21 @@ package main
 
 import (
 	"log/slog"
+	"os"
 )
 
-func main() {
-	// Information about the application.
-	slog.Info("starting HTTP server", "port", helpGetEnv("SERVER_PORT", "9876"))
+// version, commit and date are the build information of the application, set
+// by the linker flags (e.g., -X main.version=1.0.0) of the release build.
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
 
-	// Run the HTTP server.
-	if err := runServer(); err != nil {
-		slog.Error("run server", "details", err)
+func main() {
+	// Run the command from the command-line arguments (the HTTP server by default).
+	if err := runCommand(os.Args[1:]); err != nil {
+		slog.Error("run command", "details", err.Error())
+		os.Exit(1)
 	}
 }
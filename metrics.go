@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsDurationBuckets are the upper bounds of the buckets of the
+// histograms for the short durations (in seconds), e.g., HTTP requests.
+var metricsDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metricsRefreshBuckets are the upper bounds of the buckets of the histograms
+// for the long durations (in seconds), e.g., refreshes of the repositories.
+var metricsRefreshBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+var (
+	// metricRefreshes counts the refreshes of the images by their outcome ("success" or "failure").
+	metricRefreshes = newCounterVec(
+		"wonderful_readme_stats_refreshes_total", "Number of refreshes of the images.",
+		"repository", "image", "outcome",
+	)
+
+	// metricRefreshDuration observes the durations of the refreshes of the images (fetch and render).
+	metricRefreshDuration = newHistogramVec(
+		"wonderful_readme_stats_refresh_duration_seconds", "Duration of the refreshes of the images.",
+		metricsRefreshBuckets, "repository", "image",
+	)
+
+	// metricLostStargazers counts the unstars of the repositories (found by the diff of the fetched stargazers).
+	metricLostStargazers = newCounterVec(
+		"wonderful_readme_stats_lost_stargazers_total", "Number of the unstars of the repositories.",
+		"repository",
+	)
+
+	// metricAvatarDownloads counts the downloads of the avatar images by their outcome ("success" or "error").
+	metricAvatarDownloads = newCounterVec(
+		"wonderful_readme_stats_avatar_downloads_total", "Number of downloads of the avatar images.",
+		"outcome",
+	)
+
+	// metricAvatarDownloadDuration observes the durations of the downloads of the avatar images.
+	metricAvatarDownloadDuration = newHistogramVec(
+		"wonderful_readme_stats_avatar_download_duration_seconds", "Duration of the downloads of the avatar images.",
+		metricsDurationBuckets,
+	)
+
+	// metricCacheRequests counts the lookups of the encoded images in the cache by their result ("hit" or "miss").
+	metricCacheRequests = newCounterVec(
+		"wonderful_readme_stats_image_cache_requests_total", "Number of lookups of the encoded images in the cache.",
+		"result",
+	)
+
+	// metricHTTPRequests counts the HTTP requests by their endpoint and status code.
+	metricHTTPRequests = newCounterVec(
+		"wonderful_readme_stats_http_requests_total", "Number of HTTP requests.",
+		"endpoint", "status",
+	)
+
+	// metricHTTPRequestDuration observes the durations of the HTTP requests by their endpoint and status code.
+	metricHTTPRequestDuration = newHistogramVec(
+		"wonderful_readme_stats_http_request_duration_seconds", "Duration of HTTP requests.",
+		metricsDurationBuckets, "endpoint", "status",
+	)
+)
+
+// counterVec represents the Prometheus counter with the labels.
+type counterVec struct {
+	mu           sync.Mutex
+	name, help   string
+	labels       []string
+	values       map[string]float64
+	labelsValues map[string][]string
+}
+
+// newCounterVec creates a new counter with the given name, help and names of
+// the labels.
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{
+		name: name, help: help, labels: labels,
+		values: make(map[string]float64), labelsValues: make(map[string][]string),
+	}
+}
+
+// inc increments the counter with the given values of the labels.
+func (v *counterVec) inc(values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key := strings.Join(values, "\xff")
+	v.values[key]++
+	v.labelsValues[key] = values
+}
+
+// write writes the counter to the given writer in the Prometheus text format.
+func (v *counterVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", v.name, v.help, v.name)
+	for _, key := range metricsSortedKeys(v.values) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, metricsLabels(v.labels, v.labelsValues[key]), metricsValue(v.values[key]))
+	}
+}
+
+// histogram represents the observations of the Prometheus histogram with the
+// same values of the labels.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// histogramVec represents the Prometheus histogram with the labels.
+type histogramVec struct {
+	mu           sync.Mutex
+	name, help   string
+	labels       []string
+	buckets      []float64
+	values       map[string]*histogram
+	labelsValues map[string][]string
+}
+
+// newHistogramVec creates a new histogram with the given name, help, upper
+// bounds of the buckets and names of the labels.
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{
+		name: name, help: help, labels: labels, buckets: buckets,
+		values: make(map[string]*histogram), labelsValues: make(map[string][]string),
+	}
+}
+
+// observe adds the given value (e.g., the duration in seconds) to the
+// histogram with the given values of the labels.
+func (v *histogramVec) observe(value float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// Get the histogram for the values of the labels, or create a new one.
+	key := strings.Join(values, "\xff")
+	h, ok := v.values[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(v.buckets))}
+		v.values[key], v.labelsValues[key] = h, values
+	}
+
+	// Add the value to the first bucket, which fits it (the buckets are cumulated on write).
+	if index, _ := slices.BinarySearch(v.buckets, value); index < len(v.buckets) {
+		h.counts[index]++
+	}
+	h.count++
+	h.sum += value
+}
+
+// write writes the histogram to the given writer in the Prometheus text
+// format.
+func (v *histogramVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name)
+	for _, key := range metricsSortedKeys(v.values) {
+		h, values := v.values[key], v.labelsValues[key]
+
+		// Write the cumulative counts of the buckets.
+		cumulative := uint64(0)
+		for index, bound := range v.buckets {
+			cumulative += h.counts[index]
+			fmt.Fprintf(
+				w, "%s_bucket%s %d\n",
+				v.name, metricsLabels(append(slices.Clone(v.labels), "le"), append(slices.Clone(values), metricsValue(bound))),
+				cumulative,
+			)
+		}
+		fmt.Fprintf(
+			w, "%s_bucket%s %d\n",
+			v.name, metricsLabels(append(slices.Clone(v.labels), "le"), append(slices.Clone(values), "+Inf")), h.count,
+		)
+
+		// Write the sum and count of the observations.
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, metricsLabels(v.labels, values), metricsValue(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, metricsLabels(v.labels, values), h.count)
+	}
+}
+
+// metricsSortedKeys returns the sorted keys of the given map, so the output
+// of the metrics is stable.
+func metricsSortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+// metricsLabels returns the given labels with the given values in the
+// Prometheus text format (e.g., `{endpoint="/healthz",status="200"}`), or an
+// empty string if there are no labels.
+func metricsLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	// Escape the values and join them with the names.
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, 0, len(names))
+	for index, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, replacer.Replace(values[index])))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// metricsValue returns the given value in the Prometheus text format.
+func metricsValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// metricsGauge writes the gauge with the given name, help and value to the
+// given writer in the Prometheus text format.
+func metricsGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, metricsValue(value))
+}
+
+// metricsResponseWriter is a http.ResponseWriter, which remembers the status
+// code of the response.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader remembers the status code and writes it to the response.
+func (w *metricsResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the original http.ResponseWriter (e.g., for the
+// http.ResponseController).
+func (w *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// metricsHandler returns an HTTP handler, which serves the request with the
+// given handler and counts the request and its duration by the given endpoint
+// (e.g., "/github/{owner}/{repo}/{file}") and the status code.
+func metricsHandler(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Serve the request with the response writer, which remembers the status code.
+		start := time.Now()
+		recorder := &metricsResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		handler(recorder, r)
+
+		// Count the request and its duration.
+		status := strconv.Itoa(recorder.status)
+		metricHTTPRequests.inc(endpoint, status)
+		metricHTTPRequestDuration.observe(time.Since(start).Seconds(), endpoint, status)
+	}
+}
+
+// handleMetrics returns an HTTP handler, which serves all metrics of the
+// application in the Prometheus text format, and the gauges of the given
+// registry and the rate limit of the GitHub API.
+func handleMetrics(reg *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		// Write the counters and histograms.
+		metricRefreshes.write(w)
+		metricRefreshDuration.write(w)
+		metricLostStargazers.write(w)
+		metricAvatarDownloads.write(w)
+		metricAvatarDownloadDuration.write(w)
+		metricCacheRequests.write(w)
+		metricHTTPRequests.write(w)
+		metricHTTPRequestDuration.write(w)
+
+		// Write the gauges of the registry and the rate limit of the GitHub API.
+		metricsGauge(
+			w, "wonderful_readme_stats_repositories", "Number of repositories in the registry.",
+			float64(len(reg.list())),
+		)
+		if limit, remaining, resetAt, ok := githubRateLimit.get(); ok {
+			metricsGauge(
+				w, "wonderful_readme_stats_github_rate_limit_remaining", "Remaining requests to the GitHub API.",
+				float64(remaining),
+			)
+			metricsGauge(
+				w, "wonderful_readme_stats_github_rate_limit", "Limit of requests to the GitHub API.",
+				float64(limit),
+			)
+			metricsGauge(
+				w, "wonderful_readme_stats_github_rate_limit_reset_timestamp_seconds",
+				"Time of the reset of the rate limit of the GitHub API.", float64(resetAt.Unix()),
+			)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// notifyMaxUsers is the max number of the users listed in each part of the
+// text of the notification (the rest are counted only).
+const notifyMaxUsers = 20
+
+// notifyHTTPClient is the HTTP client, which is shared by all notifications
+// (so they reuse the pooled connections).
+var notifyHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// notifiersFile is the name of the file with the names of the known notifiers
+// in the state directory of the repository.
+const notifiersFile = "notifiers.json"
+
+// notifier represents the sink of the notifications about the changes of the
+// users of the repositories (e.g., the Slack incoming webhook).
+type notifier interface {
+	// name returns the name of the notifier, which is saved with the delivered events.
+	name() string
+	// notify delivers the given event.
+	notify(event historyEvent) error
+}
+
+// webhookNotifier sends the events as they are (in the JSON format) to the
+// generic webhook.
+type webhookNotifier struct{ url string }
+
+// name returns the name of the notifier.
+func (n webhookNotifier) name() string { return "webhook" }
+
+// notify sends the event in the JSON format to the URL of the notifier (with
+// no names of the notifiers, which delivered it).
+func (n webhookNotifier) notify(event historyEvent) error {
+	event.Notified = nil
+
+	return notifyPost(n.url, event)
+}
+
+// slackNotifier sends the text of the events to the Slack-compatible incoming
+// webhook.
+type slackNotifier struct{ url string }
+
+// name returns the name of the notifier.
+func (n slackNotifier) name() string { return "slack" }
+
+// notify sends the text of the event to the URL of the notifier.
+func (n slackNotifier) notify(event historyEvent) error {
+	text := makeNotifyText(event, func(user historyUser) string {
+		return fmt.Sprintf("<%s|%s>", user.ProfileURL, user.Login)
+	})
+
+	return notifyPost(n.url, map[string]string{"text": text})
+}
+
+// discordNotifier sends the text of the events to the Discord-compatible
+// webhook.
+type discordNotifier struct{ url string }
+
+// name returns the name of the notifier.
+func (n discordNotifier) name() string { return "discord" }
+
+// notify sends the text of the event to the URL of the notifier.
+func (n discordNotifier) notify(event historyEvent) error {
+	text := makeNotifyText(event, func(user historyUser) string {
+		return fmt.Sprintf("[%s](<%s>)", user.Login, user.ProfileURL)
+	})
+
+	// The content of the Discord message is limited to 2000 characters.
+	if runes := []rune(text); len(runes) > 2000 {
+		text = string(runes[:1999]) + "…"
+	}
+
+	return notifyPost(n.url, map[string]string{"content": text})
+}
+
+// notifiers returns the notifiers, which are configured by the NOTIFY_*
+// environment variables.
+func (c *Config) notifiers() []notifier {
+	notifiers := make([]notifier, 0, 3)
+	if c.Notify.WebhookURL != "" {
+		notifiers = append(notifiers, webhookNotifier{url: c.Notify.WebhookURL})
+	}
+	if c.Notify.SlackURL != "" {
+		notifiers = append(notifiers, slackNotifier{url: c.Notify.SlackURL})
+	}
+	if c.Notify.DiscordURL != "" {
+		notifiers = append(notifiers, discordNotifier{url: c.Notify.DiscordURL})
+	}
+
+	return notifiers
+}
+
+// notifyRegister registers the configured notifiers in the given stats (when
+// the repository is added to the registry, and when the configuration is
+// reloaded), before any new event is added to its history. The newly
+// configured notifiers start with the next changes: the events, which were in
+// the history before them, are marked as delivered without sending, so the
+// whole history is not replayed to them.
+func (c *Config) notifyRegister(stats *Stats) {
+	for _, n := range c.notifiers() {
+		stats.addNotifier(n.name())
+	}
+}
+
+// notifyHistory sends the events of the history of the given stats to each
+// configured notifier, which did not deliver them yet. The delivered events are
+// saved to the state directory, so they are not sent again after the restart.
+// The failed events are sent again after the next refresh. The deliveries of
+// the same stats never run at the same time.
+func (c *Config) notifyHistory(stats *Stats) {
+	stats.notifying.Lock()
+	defer stats.notifying.Unlock()
+
+	delivered := false
+	for _, n := range c.notifiers() {
+		for _, event := range stats.history() {
+			// Skip the events, which are already delivered by the notifier.
+			if slices.Contains(event.Notified, n.name()) {
+				continue
+			}
+
+			// Deliver the event, and remember it.
+			if err := n.notify(event); err != nil {
+				slog.Error("failed to send notification", "notifier", n.name(), "event", event.ID, "details", err.Error())
+				break
+			}
+			stats.markNotified(event.ID, n.name())
+			delivered = true
+		}
+	}
+
+	// Save the delivered events to the state directory, if it is set.
+	if delivered {
+		if err := c.stateSaveHistory(stats); err != nil {
+			slog.Error("failed to save history", "repository", stats.repository().String(), "details", err.Error())
+		}
+	}
+}
+
+// addNotifier remembers the notifier with the given name as the known one, and
+// marks all events of the history as delivered by it, if it is not known yet.
+func (s *Stats) addNotifier(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.Contains(s.Notifiers, name) {
+		return
+	}
+	s.Notifiers = append(slices.Clone(s.Notifiers), name)
+
+	for i := range s.History {
+		if !slices.Contains(s.History[i].Notified, name) {
+			s.History[i].Notified = append(slices.Clone(s.History[i].Notified), name)
+		}
+	}
+}
+
+// knownNotifiers returns a copy of the names of the known notifiers of the
+// stats.
+func (s *Stats) knownNotifiers() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.Notifiers)
+}
+
+// setNotifiers replaces the names of the known notifiers of the stats (e.g.,
+// with the restored ones).
+func (s *Stats) setNotifiers(names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Notifiers = names
+}
+
+// writeNotifiers writes the given names of the known notifiers to the given
+// directory.
+func writeNotifiers(dir string, names []string) error {
+	data, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, notifiersFile), data, 0o644)
+}
+
+// readNotifiers reads the names of the known notifiers from the given
+// directory. If the file does not exist (e.g., the state is saved by the
+// previous version), the notifiers, which delivered any event of the given
+// history, are known.
+func readNotifiers(dir string, history []historyEvent) ([]string, error) {
+	// Read the file of the known notifiers, if it exists.
+	data, err := os.ReadFile(filepath.Join(dir, notifiersFile))
+	if os.IsNotExist(err) {
+		names := make([]string, 0)
+		for _, event := range history {
+			for _, name := range event.Notified {
+				if !slices.Contains(names, name) {
+					names = append(names, name)
+				}
+			}
+		}
+		return names, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the names of the known notifiers.
+	names := make([]string, 0)
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("failed to decode %s (%s)", notifiersFile, err.Error())
+	}
+
+	return names, nil
+}
+
+// notifyPost sends the given payload in the JSON format to the given URL, and
+// checks the status of the response.
+func notifyPost(url string, payload any) error {
+	// Encode the payload.
+	data, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// Create a new request, which is canceled, when the application is shutting down.
+	req, err := http.NewRequestWithContext(shutdownContext, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Send the request.
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check, if the response status code is not 2xx.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("wrong status code %d for %s", resp.StatusCode, req.URL.Redacted())
+	}
+
+	return nil
+}
+
+// makeNotifyText makes the text of the notification about the given event,
+// with the users formatted by the given function (e.g., as the links).
+func makeNotifyText(event historyEvent, format func(user historyUser) string) string {
+	// Create a function to make the line with the given users.
+	line := func(users []historyUser, singular, plural string) string {
+		names := make([]string, 0, min(len(users), notifyMaxUsers))
+		for _, user := range users[:min(len(users), notifyMaxUsers)] {
+			names = append(names, format(user))
+		}
+		if len(users) > notifyMaxUsers {
+			names = append(names, fmt.Sprintf("and %d more", len(users)-notifyMaxUsers))
+		}
+
+		noun := plural
+		if len(users) == 1 {
+			noun = singular
+		}
+
+		return fmt.Sprintf("%d %s: %s", len(users), noun, strings.Join(names, ", "))
+	}
+
+	// Add the lines for the non-empty parts of the event.
+	lines := []string{fmt.Sprintf("Changes in %s:", event.Repository)}
+	if len(event.NewStargazers) > 0 {
+		lines = append(lines, "⭐ "+line(event.NewStargazers, "new stargazer", "new stargazers"))
+	}
+	if len(event.LostStargazers) > 0 {
+		lines = append(lines, "💔 "+line(event.LostStargazers, "lost stargazer", "lost stargazers"))
+	}
+	if len(event.NewContributors) > 0 {
+		lines = append(lines, "🎉 "+line(event.NewContributors, "first-time contributor", "first-time contributors"))
+	}
+
+	return strings.Join(lines, "\n")
+}
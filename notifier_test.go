@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestNotifyRegisterOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		history     []string
+		registered  []string
+		added       []string
+		wantNotices []string
+	}{
+		{"event after registration", nil, nil, []string{"new"}, []string{"new"}},
+		{"history before registration", []string{"old"}, nil, []string{"new"}, []string{"new"}},
+		{"known notifier", []string{"old"}, []string{"webhook"}, []string{"new"}, []string{"old", "new"}},
+		{"no new events", []string{"old"}, nil, nil, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create a webhook, which collects the IDs of the delivered events.
+			var mu sync.Mutex
+			notices := make([]string, 0)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				event := historyEvent{}
+				if err := jsoniter.ConfigCompatibleWithStandardLibrary.NewDecoder(r.Body).Decode(&event); err != nil {
+					t.Errorf("failed to decode event: %v", err)
+				}
+				mu.Lock()
+				notices = append(notices, event.ID)
+				mu.Unlock()
+			}))
+			defer srv.Close()
+
+			// Create the stats with the history and the notifiers known before the registration.
+			stats := newStats(&repository{Owner: "koddr", Name: "wonderful-readme-stats"}, 1)
+			for _, id := range tt.history {
+				stats.addHistory(historyEvent{ID: id})
+			}
+			stats.setNotifiers(tt.registered)
+
+			// Register the notifiers, then add the new events and notify.
+			c := &Config{Notify: &notify{WebhookURL: srv.URL}}
+			c.notifyRegister(stats)
+			for _, id := range tt.added {
+				stats.addHistory(historyEvent{ID: id})
+			}
+			c.notifyHistory(stats)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(notices) != len(tt.wantNotices) {
+				t.Fatalf("notified %v, want %v", notices, tt.wantNotices)
+			}
+			for i := range notices {
+				if notices[i] != tt.wantNotices[i] {
+					t.Errorf("notified %v, want %v", notices, tt.wantNotices)
+				}
+			}
+		})
+	}
+}
@@ -3,154 +3,563 @@ package main
 import (
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"log/slog"
 	"math"
 	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
 )
 
 // UserAvatar is a struct that represents the users avatars.
 type UserAvatar struct {
-	URL string `json:"avatar_url"`
+	Login         string      `json:"login"`
+	Type          string      `json:"type"`
+	URL           string      `json:"avatar_url"`
+	ProfileURL    string      `json:"html_url"`
+	Contributions int         `json:"contributions,omitempty"`
+	StarredAt     time.Time   `json:"-"`
+	Image         image.Image `json:"-"`
 }
 
+// avatarMaxDownloads is the max number of the avatar images downloaded at the
+// same time.
+const avatarMaxDownloads = 8
+
 // prepareAvatarImages prepares avatar images for the given list of UserAvatars.
 //
-// It takes a slice of UserAvatar objects as input and returns a slice of image.Image
-// objects and an error. The function uses the URLs of the avatars to download the
-// images using HTTP and decodes them into image.Image objects. It then returns the
-// downloaded images and any errors encountered during the process.
-func (c *Config) prepareAvatarImages(avatars []UserAvatar) ([]image.Image, error) {
-	// Create a slice of image.Image objects to store the downloaded avatar images.
-	images := make([]image.Image, len(avatars))
-
-	// Create two channels to receive the downloaded images and errors.
-	imageChan := make(chan image.Image, len(avatars))
-	errChan := make(chan error, len(avatars))
+// It takes a slice of UserAvatar objects as input and returns a new slice of
+// UserAvatar objects with the decoded images. The function uses the URLs of
+// the avatars to download the images using HTTP (avatarMaxDownloads at the
+// same time) and decodes them into image.Image objects. The order of the given
+// users is preserved. The failed avatars are logged and skipped (the users are
+// left without the image), so one broken avatar does not fail the refresh.
+func (c *Config) prepareAvatarImages(avatars []UserAvatar) []UserAvatar {
+	// Create a slice of UserAvatar objects to store the downloaded avatar images.
+	images := slices.Clone(avatars)
+
+	// Create a semaphore to limit the concurrent downloads, and a wait group to wait for them.
+	semaphore := make(chan struct{}, avatarMaxDownloads)
+	var wg sync.WaitGroup
 
 	// Iterate over the avatars.
-	for _, avatar := range avatars {
-		go func(url string) {
+	for index := range images {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(avatar *UserAvatar) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			// Count the download and its duration with the outcome ("error" until the image is decoded).
+			start, outcome := time.Now(), "error"
+			defer func() {
+				metricAvatarDownloads.inc(outcome)
+				metricAvatarDownloadDuration.observe(time.Since(start).Seconds())
+			}()
+
 			// Download the image from the given URL using the custom HTTP client.
-			resp, err := c.helpCustomHTTPClient(url)
+			resp, err := c.helpCustomHTTPClient(avatar.URL, "")
 			if err != nil {
-				// If there is an error, send it to the error channel and return.
-				slog.Error("failed to make HTTP response", "url", url, "details", err.Error())
-				errChan <- err
+				slog.Error("failed to make HTTP response", "url", avatar.URL, "details", err.Error())
 				return
 			}
 			defer resp.Body.Close()
 
 			// Check, if the response status code is not 200.
 			if resp.StatusCode != http.StatusOK {
-				// If the status code is not 200, log the error message, close the channel, and return.
-				slog.Error("failed to fetch avatar image", "url", url, "status_code", resp.StatusCode)
-				errChan <- err
+				slog.Error("failed to fetch avatar image", "url", avatar.URL, "status_code", resp.StatusCode)
 				return
 			}
 
 			// Decode the downloaded image into an image.Image object.
 			img, _, err := image.Decode(resp.Body)
 			if err != nil {
-				// If there is an error, send it to the error channel and return.
-				slog.Error("failed to decode avatar image", "url", url, "details", err.Error())
-				errChan <- err
+				slog.Error("failed to decode avatar image", "url", avatar.URL, "details", err.Error())
 				return
 			}
 
-			// Send the downloaded image to the image channel.
-			imageChan <- img
-		}(avatar.URL)
+			// Store the downloaded image to the user at the same index.
+			outcome = "success"
+			avatar.Image = img
+		}(&images[index])
 	}
 
-	// Iterate over the avatars again to retrieve the downloaded images and handle errors.
-	for index := range avatars {
-		select {
-		case img := <-imageChan:
-			// If an image is received from the image channel, store it in the images slice.
-			images[index] = img
-		case err := <-errChan:
-			// If an error is received from the error channel, return the error.
-			return nil, fmt.Errorf("failed to prepare avatar image (%s)", err.Error())
+	// Wait for all downloads.
+	wg.Wait()
+
+	return images
+}
+
+// prepareStoreImages returns a copy of the given store, where the users, who
+// will be actually rendered by the images of the given repository (the full
+// grid of each image after its filters and order), have the avatar images.
+//
+// The images of the same avatars (by their URLs, which change with the
+// avatars) are taken from the given cached store, and only the missing ones
+// are downloaded. The other users are left without the images.
+func (c *Config) prepareStoreImages(repo *repository, store, cached ImageStore) ImageStore {
+	// Collect the cached avatar images by their URLs.
+	cachedImages := make(map[string]image.Image)
+	for _, avatar := range append(slices.Clone(cached.Stargazers), cached.Contributors...) {
+		if avatar.Image != nil {
+			cachedImages[avatar.URL] = avatar.Image
 		}
 	}
 
-	// Close the channels.
-	close(imageChan)
-	close(errChan)
+	// Create a function to set the avatar images of the rendered users of the given source.
+	prepare := func(source string, avatars []UserAvatar) []UserAvatar {
+		// Collect the URLs of the users, who will be rendered by any image of the source.
+		rendered := make(map[string]bool)
+		for _, def := range repo.Images {
+			if def.Source != source {
+				continue
+			}
+			filtered := prepareImageAvatars(avatars, def)
+			for _, avatar := range filtered[:min(len(filtered), def.Options.MaxPerRow*def.Options.MaxRows)] {
+				rendered[avatar.URL] = true
+			}
+		}
 
-	// Return the downloaded images and nil (no error).
-	return images, nil
+		// Set the cached images, and collect the users with the missing ones.
+		avatars = slices.Clone(avatars)
+		missing := make([]int, 0)
+		for index := range avatars {
+			avatars[index].Image = nil
+			if !rendered[avatars[index].URL] {
+				continue
+			}
+			if img, ok := cachedImages[avatars[index].URL]; ok {
+				avatars[index].Image = img
+				continue
+			}
+			missing = append(missing, index)
+		}
+
+		// Download the missing images.
+		downloads := make([]UserAvatar, 0, len(missing))
+		for _, index := range missing {
+			downloads = append(downloads, avatars[index])
+		}
+		for i, avatar := range c.prepareAvatarImages(downloads) {
+			avatars[missing[i]].Image = avatar.Image
+		}
+
+		return avatars
+	}
+
+	// Set the avatar images of both sources (the complete flags and the max number of pages are kept).
+	store.Stargazers = prepare("stargazers", store.Stargazers)
+	store.Contributors = prepare("contributors", store.Contributors)
+
+	return store
 }
 
-// prepareFinalImage takes a slice of image URLs as input. It returns a new
-// image.NRGBA object that represents the final image composed of all the
-// prepared images.
-func (c *Config) prepareFinalImage(imageUrls []image.Image) (*image.NRGBA, error) {
-	// Set total number of images.
-	totalImages := c.OutputImage.MaxPerRow * c.OutputImage.MaxRows
+// prepareImageAvatars filters and orders the given users by the definition of
+// the image. It returns a new slice, the given one is not changed.
+//
+// The users are filtered by the excluded logins (with the glob patterns, e.g.
+// "*[bot]"), bots and the min number of contributions. The users are ordered
+// by the order of the image: "default" (as returned by the GitHub API),
+// "newest" or "oldest" (by the time of starring), "login" (alphabetically) or
+// "contributions" (the most active first).
+func prepareImageAvatars(avatars []UserAvatar, def *imageDefinition) []UserAvatar {
+	// Create a slice to store the filtered users.
+	filtered := make([]UserAvatar, 0, len(avatars))
 
-	// Calculate the number of rows and images per row.
-	if imagesCount := len(imageUrls); imagesCount < totalImages {
-		c.OutputImage.MaxRows = min(
-			c.OutputImage.MaxRows,
-			int(math.Ceil(float64(imagesCount)/float64(c.OutputImage.MaxPerRow))),
+	for _, avatar := range avatars {
+		// Skip the bots, if needed.
+		if def.Filters.ExcludeBots && (avatar.Type == "Bot" || strings.HasSuffix(avatar.Login, "[bot]")) {
+			continue
+		}
+
+		// Skip the users with fewer contributions, if needed.
+		if def.Source == "contributors" && avatar.Contributions < def.Filters.MinContributions {
+			continue
+		}
+
+		// Skip the excluded users.
+		if slices.ContainsFunc(def.Filters.Exclude, func(pattern string) bool {
+			matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(avatar.Login))
+			return matched
+		}) {
+			continue
+		}
+
+		filtered = append(filtered, avatar)
+	}
+
+	// Order the filtered users (the stable sort keeps the order of the GitHub API for equal users).
+	switch def.Order {
+	case "newest":
+		slices.SortStableFunc(filtered, func(a, b UserAvatar) int { return b.StarredAt.Compare(a.StarredAt) })
+	case "oldest":
+		slices.SortStableFunc(filtered, func(a, b UserAvatar) int { return a.StarredAt.Compare(b.StarredAt) })
+	case "login":
+		slices.SortStableFunc(filtered, func(a, b UserAvatar) int {
+			return strings.Compare(strings.ToLower(a.Login), strings.ToLower(b.Login))
+		})
+	case "contributions":
+		slices.SortStableFunc(filtered, func(a, b UserAvatar) int { return b.Contributions - a.Contributions })
+	}
+
+	return filtered
+}
+
+// renderOptions represents the options to render the final image: the shape,
+// size, margins and radius of the avatars, the grid of the final image, the
+// scale factor for the HiDPI screens, and the labels with the logins of the
+// users ("none", "below" or "beside" the avatars) with their font, size,
+// color and max width (of the labels beside the avatars).
+type renderOptions struct {
+	Shape                                                      string
+	Size, HorizontalMargin, VerticalMargin, MaxPerRow, MaxRows int
+	RoundedRadius                                              float64
+	Scale                                                      int
+	Label, LabelFont                                           string
+	LabelSize, LabelWidth                                      int
+	LabelColor                                                 color.NRGBA
+}
+
+// renderMaxPixels is the max number of the pixels of the final image rendered
+// on demand with the options from the query (4096x4096, or 64 MB of the NRGBA
+// pixels).
+const renderMaxPixels = 4096 * 4096
+
+// renderSlots limits the number of the final images rendered on demand at the
+// same time, so many different variants cannot exhaust the memory together
+// (the other renders wait for a free slot).
+var renderSlots = make(chan struct{}, 4)
+
+// defaultRenderOptions returns the options to render the final image from the
+// avatar and output image configuration of the application (with the 1x scale).
+func (c *Config) defaultRenderOptions() renderOptions {
+	return renderOptions{
+		Shape:            c.Avatar.Shape,
+		Size:             c.Avatar.Size,
+		HorizontalMargin: c.Avatar.HorizontalMargin,
+		VerticalMargin:   c.Avatar.VerticalMargin,
+		MaxPerRow:        c.OutputImage.MaxPerRow,
+		MaxRows:          c.OutputImage.MaxRows,
+		RoundedRadius:    c.Avatar.RoundedRadius,
+		Scale:            1,
+		Label:            c.Avatar.Label,
+		LabelFont:        c.Avatar.LabelFont,
+		LabelSize:        c.Avatar.LabelSize,
+		LabelWidth:       c.Avatar.LabelWidth,
+		LabelColor:       c.Avatar.LabelColor,
+	}
+}
+
+// prepareRenderOptions returns the render options with the values from the
+// given query parameters ("shape", "size", "cols", "rows", "gap", "radius",
+// "scale", "label", "label_size", "label_width" and "label_color") over the
+// given base ones. Each value is validated against its bounds (the size of
+// the whole image is checked by the prepareRenderSize function).
+//
+// It returns an error, if any value is not valid.
+func prepareRenderOptions(o renderOptions, query url.Values) (renderOptions, error) {
+	// Set the shape of the avatars, if it exists.
+	if shape := query.Get("shape"); shape != "" {
+		if shape != "rounded" && shape != "circular" && shape != "square" {
+			return renderOptions{}, fmt.Errorf("wrong shape '%s' (must be one of: rounded, circular, square)", shape)
+		}
+		o.Shape = shape
+	}
+
+	// Set the position of the labels, if it exists.
+	if label := query.Get("label"); label != "" {
+		if label != "none" && label != "below" && label != "beside" {
+			return renderOptions{}, fmt.Errorf("wrong label '%s' (must be one of: none, below, beside)", label)
+		}
+		o.Label = label
+	}
+
+	// Set the color of the labels, if it exists.
+	if labelColor := query.Get("label_color"); labelColor != "" {
+		parsed, err := helpParseHexColor(labelColor)
+		if err != nil {
+			return renderOptions{}, err
+		}
+		o.LabelColor = parsed
+	}
+
+	// Create a list of the integer parameters with their bounds.
+	params := []struct {
+		name     string
+		min, max int
+		targets  []*int
+	}{
+		{"size", 16, 256, []*int{&o.Size}},
+		{"cols", 1, 32, []*int{&o.MaxPerRow}},
+		{"rows", 1, 16, []*int{&o.MaxRows}},
+		{"gap", 0, 64, []*int{&o.HorizontalMargin, &o.VerticalMargin}},
+		{"scale", 1, 3, []*int{&o.Scale}},
+		{"label_size", 6, 48, []*int{&o.LabelSize}},
+		{"label_width", 16, 256, []*int{&o.LabelWidth}},
+	}
+
+	// Parse the integer parameters, if they exist.
+	for _, param := range params {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < param.min || parsed > param.max {
+			return renderOptions{}, fmt.Errorf(
+				"wrong %s '%s' (must be an integer from %d to %d)", param.name, value, param.min, param.max,
+			)
+		}
+
+		for _, target := range param.targets {
+			*target = parsed
+		}
+	}
+
+	// Set the radius of the corners, if it exists, or limit the default one by the size.
+	if radius := query.Get("radius"); radius != "" {
+		parsed, err := strconv.ParseFloat(radius, 64)
+		if err != nil || parsed < 0 || parsed > float64(o.Size)/2 {
+			return renderOptions{}, fmt.Errorf("wrong radius '%s' (must be a number from 0 to %d)", radius, o.Size/2)
+		}
+		o.RoundedRadius = parsed
+	} else {
+		o.RoundedRadius = min(o.RoundedRadius, float64(o.Size)/2)
+	}
+
+	return o, nil
+}
+
+// scaled returns a copy of the options with the size, margins and radius of
+// the avatars and the size and width of the labels multiplied by the scale
+// factor (and the 1x scale).
+func (o renderOptions) scaled() renderOptions {
+	// Set the scale factor to 1x, if it is not set.
+	scale := max(o.Scale, 1)
+
+	// Multiply the sizes by the scale factor.
+	o.Size, o.HorizontalMargin, o.VerticalMargin = o.Size*scale, o.HorizontalMargin*scale, o.VerticalMargin*scale
+	o.RoundedRadius *= float64(scale)
+	o.LabelSize, o.LabelWidth = o.LabelSize*scale, o.LabelWidth*scale
+	o.Scale = 1
+
+	return o
+}
+
+// prepareImageSize calculates the size of the final image with the full grid
+// (the max number of images per row and the max number of rows) for the given
+// render options with the scale factor, with the labels of the avatars (if
+// they are set by the options).
+func prepareImageSize(o renderOptions) (width, height int, err error) {
+	// Set the sizes of the avatars and the labels with the scale factor.
+	o = o.scaled()
+
+	// Create the font face of the labels, if they are set.
+	face, err := prepareLabelFace(o)
+	if err != nil {
+		return 0, 0, err
+	}
+	if face != nil {
+		defer face.Close()
+	}
+
+	// Calculate the size of the tile with the label.
+	tileWidth, rowHeight, _ := prepareTileSize(o, face)
+
+	width = o.MaxPerRow*tileWidth + (o.MaxPerRow-1)*o.HorizontalMargin
+	height = o.MaxRows*rowHeight + (o.MaxRows-1)*o.VerticalMargin
+
+	return width, height, nil
+}
+
+// prepareRenderSize checks, that the final image with the full grid rendered
+// with the given options is not larger than renderMaxPixels. It returns an
+// error, if the image is too large.
+func prepareRenderSize(o renderOptions) error {
+	// Calculate the size of the final image with the full grid.
+	width, height, err := prepareImageSize(o)
+	if err != nil {
+		return err
+	}
+
+	// Check the number of the pixels of the final image.
+	if width*height > renderMaxPixels {
+		return fmt.Errorf(
+			"too large image %dx%d (must be at most %d pixels, reduce the size, cols, rows, gap, labels or scale)",
+			width, height, renderMaxPixels,
 		)
-		c.OutputImage.MaxPerRow = min(c.OutputImage.MaxPerRow, imagesCount)
-		totalImages = imagesCount
 	}
 
-	preparedImages := make([]image.Image, 0, totalImages) // create a new slice to store prepared images
-	imageChan := make(chan image.Image, totalImages)      // channel to receive resized and rounded images
-	errorChan := make(chan error, totalImages)            // channel to receive error messages
+	return nil
+}
+
+// prepareLabelFace creates the font face of the labels of the avatars for the
+// given render options (already scaled). It returns nil, if the labels are
+// not set by the options.
+func prepareLabelFace(o renderOptions) (font.Face, error) {
+	if o.Label != "below" && o.Label != "beside" {
+		return nil, nil
+	}
+
+	parsed, err := helpLoadFont(o.LabelFont)
+	if err != nil {
+		return nil, err
+	}
+
+	return truetype.NewFace(parsed, &truetype.Options{Size: float64(o.LabelSize), Hinting: font.HintingFull}), nil
+}
+
+// prepareTileSize calculates the size of the tile of the grid for the given
+// render options (already scaled) and the given font face of the labels (nil
+// without the labels): the label below the avatar makes the row higher, and
+// the label beside the avatar makes the tile wider. It returns the gap between
+// the avatar and its label too.
+func prepareTileSize(o renderOptions, face font.Face) (tileWidth, rowHeight, labelGap int) {
+	// Return the size of the avatar, if there are no labels.
+	if face == nil {
+		return o.Size, o.Size, 0
+	}
+
+	// Add the gap and the label to the size of the avatar.
+	labelGap, labelHeight := max(2, o.LabelSize/3), face.Metrics().Height.Ceil()
+	if o.Label == "below" {
+		return o.Size, o.Size + labelGap + labelHeight, labelGap
+	}
+
+	return o.Size + labelGap + o.LabelWidth, max(o.Size, labelHeight), labelGap
+}
+
+// prepareGridSize calculates the number of images per row and the number of
+// rows of the final image for the given number of images. The result is
+// limited by the given render options.
+func prepareGridSize(imagesCount int, o renderOptions) (perRow, rows int) {
+	// Set the number of images per row and the number of rows from the options.
+	perRow, rows = o.MaxPerRow, o.MaxRows
+
+	// Calculate the number of rows and images per row.
+	if imagesCount < perRow*rows {
+		rows = min(rows, int(math.Ceil(float64(imagesCount)/float64(perRow))))
+		perRow = min(perRow, imagesCount)
+	}
+
+	return perRow, rows
+}
+
+// prepareVisibleAvatars returns the users, which will be shown on the final
+// image, in the same order as they will be rendered. The users without the
+// avatar images (e.g., the failed downloads) are skipped.
+func prepareVisibleAvatars(avatars []UserAvatar, o renderOptions) []UserAvatar {
+	// Collect the users with the avatar images.
+	avatars = slices.DeleteFunc(slices.Clone(avatars), func(avatar UserAvatar) bool { return avatar.Image == nil })
+
+	// Calculate the grid size of the final image.
+	perRow, rows := prepareGridSize(len(avatars), o)
+
+	return avatars[:min(len(avatars), perRow*rows)]
+}
+
+// prepareFinalImage takes a slice of users with avatar images and the render
+// options as input. It returns a new image.NRGBA object that represents the
+// final image composed of all the prepared images.
+//
+// The avatars are resized from the original-resolution images, so the final
+// image with the 2x or 3x scale stays sharp on the HiDPI screens.
+func prepareFinalImage(avatars []UserAvatar, o renderOptions) (*image.NRGBA, error) {
+	// Set the users, which will be shown on the final image.
+	avatars = prepareVisibleAvatars(avatars, o)
+
+	// Set the sizes of the avatars with the scale factor.
+	o = o.scaled()
+
+	preparedImages := make([]image.Image, len(avatars)) // create a new slice to store prepared images
+	imageChan := make(chan int, len(avatars))           // channel to receive indexes of resized and rounded images
+	errorChan := make(chan error, len(avatars))         // channel to receive error messages
 
 	// Fetch, resize and round the images concurrently.
-	for _, url := range imageUrls {
-		go func(url image.Image) {
+	for index, avatar := range avatars {
+		go func(index int, url image.Image) {
 			// Resize the image.
-			img := makeImageResize(url, c.Avatar.Size, c.Avatar.Size)
+			img := makeImageResize(url, o.Size, o.Size)
 
-			switch c.Avatar.Shape {
+			switch o.Shape {
 			case "rounded":
 				// Round the image.
-				img = makeImageRounded(img, c.Avatar.RoundedRadius)
+				img = makeImageRounded(img, o.RoundedRadius)
 			case "circular":
 				// Circular the image.
 				img = makeImageCircular(img)
 			}
 
-			// Send the rounded image to the imageChan channel.
-			imageChan <- img
-		}(url)
+			// Store the rounded image at the same index and send the index to the imageChan channel.
+			preparedImages[index] = img
+			imageChan <- index
+		}(index, avatar.Image)
 	}
 
-	// Collect the prepared images from the channel.
-	for range imageUrls {
+	// Wait for the prepared images from the channel.
+	for range avatars {
 		select {
-		case imageData := <-imageChan:
-			preparedImages = append(preparedImages, imageData) // append the image to the preparedImages slice
+		case <-imageChan:
+			// The image is already stored in the preparedImages slice.
 		case err := <-errorChan:
 			return nil, err
 		}
 	}
 
+	// Calculate the grid size of the final image.
+	perRow, rows := prepareGridSize(len(avatars), o)
+
+	// Collect the logins of the users for the labels.
+	labels := make([]string, len(avatars))
+	for index, avatar := range avatars {
+		labels[index] = avatar.Login
+	}
+
 	// Prepare the final image using the prepared images and image parameters.
-	return c.prepareFinalImageInternal(preparedImages), nil
+	return prepareFinalImageInternal(preparedImages, labels, perRow, rows, o)
 }
 
 // prepareFinalImageInternal is a helper function that takes a slice of prepared
-// images, image size, number of images per row, number of rows, horizontal
-// margin, and vertical margin as input.
+// images, the labels of the images, number of images per row, number of rows
+// and the render options (already scaled) as input.
 //
 // It returns a new image.NRGBA object that represents the final image composed
-// of all the prepared images.
-func (c *Config) prepareFinalImageInternal(preparedImages []image.Image) *image.NRGBA {
+// of all the prepared images. If the labels are set by the options, each tile
+// of the grid has the avatar with its label (truncated with the ellipsis to
+// fit the tile): the label below the avatar makes the row higher, and the
+// label beside the avatar makes the tile wider.
+func prepareFinalImageInternal(
+	preparedImages []image.Image, labels []string, perRow, rows int, o renderOptions,
+) (*image.NRGBA, error) {
+	// Create the font face of the labels, if they are set.
+	face, err := prepareLabelFace(o)
+	if err != nil {
+		return nil, err
+	}
+	if face != nil {
+		defer face.Close()
+	}
+
+	// Calculate the size of the tile with the label.
+	tileWidth, rowHeight, labelGap := prepareTileSize(o, face)
+
 	// Calculate the total height of the final image.
-	rowHeight := c.Avatar.Size
-	totalHeight := c.OutputImage.MaxRows*rowHeight + (c.OutputImage.MaxRows-1)*c.Avatar.VerticalMargin
+	totalHeight := rows*rowHeight + (rows-1)*o.VerticalMargin
 
 	// Calculate the total width of the final image.
-	totalWidth := c.OutputImage.MaxPerRow*c.Avatar.Size + (c.OutputImage.MaxPerRow-1)*c.Avatar.HorizontalMargin
+	totalWidth := perRow*tileWidth + (perRow-1)*o.HorizontalMargin
 
 	// Create a blank final image with transparent background.
 	finalImage := image.NewNRGBA(image.Rect(0, 0, totalWidth, totalHeight))
@@ -158,19 +567,34 @@ func (c *Config) prepareFinalImageInternal(preparedImages []image.Image) *image.
 	// Paste the prepared images onto the final image.
 	for i, img := range preparedImages {
 		// Calculate the row and column of the image.
-		row := i / c.OutputImage.MaxPerRow
-		col := i % c.OutputImage.MaxPerRow
+		row := i / perRow
+		col := i % perRow
 
-		// Calculate the offset of the image.
-		offsetX := col * (c.Avatar.Size + c.Avatar.HorizontalMargin)
-		offsetY := row * (rowHeight + c.Avatar.VerticalMargin)
+		// Calculate the offset of the tile, and the offset of the image in the tile (centered by the label beside).
+		offsetX := col * (tileWidth + o.HorizontalMargin)
+		offsetY := row * (rowHeight + o.VerticalMargin)
+		imageY := offsetY
+		if o.Label == "beside" {
+			imageY += (rowHeight - o.Size) / 2
+		}
 
 		// Paste the image onto the final image.
 		draw.Draw(
-			finalImage, image.Rect(offsetX, offsetY, offsetX+c.Avatar.Size, offsetY+rowHeight),
+			finalImage, image.Rect(offsetX, imageY, offsetX+o.Size, imageY+o.Size),
 			img, image.Point{}, draw.Src,
 		)
+
+		// Draw the label of the image, if it is set.
+		if face == nil || i >= len(labels) {
+			continue
+		}
+		if o.Label == "below" {
+			makeImageLabel(finalImage, face, labels[i], offsetX, offsetY+o.Size+labelGap, o.Size, true, o.LabelColor)
+		} else {
+			labelY := offsetY + (rowHeight-face.Metrics().Height.Ceil())/2
+			makeImageLabel(finalImage, face, labels[i], offsetX+o.Size+labelGap, labelY, o.LabelWidth, false, o.LabelColor)
+		}
 	}
 
-	return finalImage
+	return finalImage, nil
 }
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errRepositoryNotAllowed is returned when the requested repository is not in
+// the allowlist of the application.
+var errRepositoryNotAllowed = errors.New("repository is not allowed")
+
+// Registry is a struct that represents the registry of the repositories, which
+// are served by the application. Each repository is fetched lazily on the
+// first request, refreshed on its own schedule, and evicted after it goes
+// unused for the idle timeout.
+type Registry struct {
+	mu      sync.Mutex
+	entries map[string]*registryEntry
+	flights *flightGroup
+}
+
+// registryEntry represents a repository in the registry.
+type registryEntry struct {
+	stats    *Stats
+	lastUsed time.Time
+	pinned   bool
+	stop     chan struct{}
+}
+
+// newRegistry creates a new empty Registry.
+func newRegistry() *Registry {
+	return &Registry{entries: make(map[string]*registryEntry), flights: newFlightGroup()}
+}
+
+// registryKey returns the key of the given repository in the registry. The
+// names of the repositories on GitHub are case-insensitive.
+func registryKey(owner, name string) string {
+	return strings.ToLower(owner + "/" + name)
+}
+
+// isDefault checks, if the given repository is the default repository of the
+// application.
+func (c *Config) isDefault(owner, name string) bool {
+	return registryKey(owner, name) == registryKey(c.Repository.Owner, c.Repository.Name)
+}
+
+// isDeclared returns the repository with the given name declared in the
+// configuration file, or nil if it is not declared.
+func (c *Config) isDeclared(owner, name string) *repository {
+	for _, repo := range c.Repositories.Declared {
+		if registryKey(repo.Owner, repo.Name) == registryKey(owner, name) {
+			return repo
+		}
+	}
+
+	return nil
+}
+
+// repositoryFor returns the repository with the given name: the declared one
+// (with its own images and refresh interval), or a new one with the images and
+// refresh interval of the default repository.
+func (c *Config) repositoryFor(owner, name string) *repository {
+	if repo := c.isDeclared(owner, name); repo != nil {
+		return repo
+	}
+
+	return &repository{
+		Owner: owner, Name: name, RefreshInterval: c.Repository.RefreshInterval, Images: c.Repository.Images,
+	}
+}
+
+// isAllowed checks, if the given repository is the default one, declared in the
+// configuration file or it is in the allowlist. The allowlist contains the
+// owners (e.g., "koddr") or the full names of the repositories (e.g.,
+// "koddr/wonderful-readme-stats").
+func (c *Config) isAllowed(owner, name string) bool {
+	if c.isDefault(owner, name) || c.isDeclared(owner, name) != nil {
+		return true
+	}
+
+	for _, item := range c.Repositories.Allowlist {
+		if strings.EqualFold(item, owner) || strings.EqualFold(item, owner+"/"+name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// registryGet returns the stats of the given repository from the registry.
+//
+// If the repository is not in the registry yet, its stats are fetched and
+// prepared, then the repository is added to the registry with its own
+// updating goroutine. The default and declared repositories are never evicted
+// from the registry.
+//
+// The concurrent requests for the same cold repository are coalesced into one
+// in-flight fetch. If the timeout is not 0 and the fetch is not done before the
+// timeout, it returns the errFlightTimeout error (the fetch keeps running in
+// the background).
+func (c *Config) registryGet(reg *Registry, owner, name string, timeout time.Duration) (*Stats, error) {
+	// Check, if the repository is in the allowlist.
+	if !c.isAllowed(owner, name) {
+		return nil, errRepositoryNotAllowed
+	}
+
+	// Create a key for the repository.
+	key := registryKey(owner, name)
+
+	// Return the stats of the repository, if it exists in the registry.
+	reg.mu.Lock()
+	if entry, ok := reg.entries[key]; ok {
+		entry.lastUsed = time.Now()
+		reg.mu.Unlock()
+		return entry.stats, nil
+	}
+	reg.mu.Unlock()
+
+	// Fetch the repository in the in-flight call (or join the existing one).
+	call := reg.flights.do(key, func() (any, error) {
+		return c.registryAdd(reg, owner, name)
+	})
+
+	// Wait for the result of the in-flight call.
+	stats, err := call.wait(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats.(*Stats), nil
+}
+
+// registryAdd fetches the avatar images and prepares the final images of the
+// given repository, then adds it to the registry with its own updating
+// goroutine. If the last good state of the repository is persisted to the
+// state directory, it is restored instead, and the first update runs in the
+// background.
+func (c *Config) registryAdd(reg *Registry, owner, name string) (*Stats, error) {
+	// Restore the last good state of the repository from the state directory, if it exists.
+	stats, err := c.stateLoad(c.repositoryFor(owner, name))
+	if err != nil {
+		slog.Warn("failed to restore state", "repository", registryKey(owner, name), "details", err.Error())
+	}
+	restored := stats != nil
+	if !restored {
+		stats = newStats(c.repositoryFor(owner, name), c.OutputImage.CacheSize)
+	}
+
+	// Register the configured notifiers, so they are notified about the changes found from now on.
+	c.notifyRegister(stats)
+
+	// Fetch the avatar images and prepare the final images of the repository, if it is not restored.
+	if !restored {
+		if err := c.updateStats(stats); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create a key for the repository.
+	key := registryKey(owner, name)
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	// Return the stats of the repository, if it was added to the registry in the meantime.
+	if entry, ok := reg.entries[key]; ok {
+		entry.lastUsed = time.Now()
+		return entry.stats, nil
+	}
+
+	// Add the repository to the registry.
+	entry := &registryEntry{
+		stats:    stats,
+		lastUsed: time.Now(),
+		pinned:   c.isDefault(owner, name) || c.isDeclared(owner, name) != nil,
+		stop:     make(chan struct{}),
+	}
+	reg.entries[key] = entry
+
+	// Start a goroutine to continuously update the final images of the repository (the restored one is updated
+	// right away, while the restored images are served).
+	go func(stop <-chan struct{}) {
+		if restored {
+			if err := c.updateStats(stats); err != nil {
+				slog.Error("failed to update final images", "repository", stats.repository().String(), "details", err.Error())
+			}
+		}
+		c.updateFinalImage(stats, stop)
+	}(entry.stop)
+
+	return stats, nil
+}
+
+// list returns the stats of all repositories in the registry, ordered by the
+// names of the repositories.
+func (reg *Registry) list() []*Stats {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	// Collect the keys of the repositories in order.
+	keys := make([]string, 0, len(reg.entries))
+	for key := range reg.entries {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	// Collect the stats of the repositories by the keys.
+	list := make([]*Stats, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, reg.entries[key].stats)
+	}
+
+	return list
+}
+
+// lookup returns the stats of the given repository, if it is in the registry,
+// without marking it as used.
+func (reg *Registry) lookup(owner, name string) (*Stats, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	entry, ok := reg.entries[registryKey(owner, name)]
+	if !ok {
+		return nil, false
+	}
+
+	return entry.stats, true
+}
+
+// registryEvict runs in a separate goroutine and evicts the repositories,
+// which were not used for the idle timeout, from the given registry.
+func (c *Config) registryEvict(reg *Registry) {
+	// Set the idle timeout for the repositories.
+	idleTimeout := time.Duration(c.Repositories.IdleTimeout) * time.Second
+
+	// Create a new ticker to check the repositories.
+	ticker := time.NewTicker(max(min(idleTimeout, time.Minute), time.Second))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reg.mu.Lock()
+		for key, entry := range reg.entries {
+			// Skip the pinned and recently used repositories.
+			if entry.pinned || time.Since(entry.lastUsed) < idleTimeout {
+				continue
+			}
+
+			// Stop the updating goroutine and remove the repository from the registry.
+			close(entry.stop)
+			delete(reg.entries, key)
+
+			slog.Info("evicted unused repository", "repository", entry.stats.repository().String())
+		}
+		reg.mu.Unlock()
+	}
+}
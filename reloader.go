@@ -0,0 +1,198 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// reloadWatch runs in a separate goroutine and reloads the configuration of
+// the application on the SIGHUP signal, or when the modification time of the
+// configuration file is changed (checked every CONFIG_WATCH_INTERVAL seconds,
+// 0 to disable). The new configuration is stored to the given pointer, so the
+// next requests are served with it.
+//
+// If the new configuration is not valid, the problems are logged and the
+// current configuration is kept.
+func reloadWatch(current *atomic.Pointer[Config], reg *Registry) {
+	// Create a channel to receive the SIGHUP signal.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	// Create a new ticker to check the configuration file, if it is set.
+	var ticks <-chan time.Time
+	if c := current.Load(); c.ConfigFile != "" && c.ConfigWatchInterval > 0 {
+		ticker := time.NewTicker(time.Duration(c.ConfigWatchInterval) * time.Second)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	// Remember the modification time of the configuration file.
+	modTime := reloadModTime(current.Load().ConfigFile)
+
+	for {
+		// Wait for the signal or the next check of the configuration file.
+		select {
+		case <-signals:
+			slog.Info("received SIGHUP, reloading configuration")
+		case <-ticks:
+			// Skip the reload, if the configuration file is not changed.
+			changed := reloadModTime(current.Load().ConfigFile)
+			if changed.Equal(modTime) {
+				continue
+			}
+			slog.Info("configuration file changed, reloading configuration", "path", current.Load().ConfigFile)
+		}
+
+		// Remember the modification time of the configuration file for the next check.
+		modTime = reloadModTime(current.Load().ConfigFile)
+
+		// Validate the new configuration.
+		next, err := validateEnvVariables()
+		if err != nil {
+			slog.Error("failed to reload configuration, keeping the current one", "details", err.Error())
+			continue
+		}
+
+		// Apply the new configuration to the repositories in the registry, and serve the next requests with it.
+		next.reloadRegistry(current.Load(), reg)
+		current.Store(next)
+
+		slog.Info("successfully reloaded configuration")
+	}
+}
+
+// reloadModTime returns the modification time of the given configuration file,
+// or the zero time if it is not set or cannot be read.
+func reloadModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+
+	info, err := os.Stat(filepath.Clean(path))
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// reloadRegistry applies the configuration to the repositories in the given
+// registry, which were added with the given previous configuration.
+//
+// For each repository, the final images are re-fetched only if the sources or
+// filters of its images (or the GitHub API settings) are changed. If only the
+// visual settings are changed (e.g., the shape of the avatars or the size of
+// the grid), the final images are re-rendered from the cached avatars without
+// any requests to the GitHub API. The repositories, which are no longer
+// allowed, are removed from the registry.
+//
+// The settings of the HTTP server and the idle timeout of the repositories
+// are not reloaded, the application must be restarted to apply them.
+func (c *Config) reloadRegistry(prev *Config, reg *Registry) {
+	// Warn about the settings, which cannot be reloaded.
+	if *c.Server != *prev.Server || c.Repositories.IdleTimeout != prev.Repositories.IdleTimeout {
+		slog.Warn("server settings and the idle timeout of the repositories are applied after restart only")
+	}
+
+	// Get the current entries of the registry.
+	reg.mu.Lock()
+	entries := make(map[string]*registryEntry, len(reg.entries))
+	for key, entry := range reg.entries {
+		entries[key] = entry
+	}
+	reg.mu.Unlock()
+
+	for key, entry := range entries {
+		// Get the previous and the new definitions of the repository.
+		old := entry.stats.repository()
+		repo := c.repositoryFor(old.Owner, old.Name)
+
+		// Remove the repository from the registry, if it is no longer allowed.
+		if !c.isAllowed(old.Owner, old.Name) {
+			reg.mu.Lock()
+			if current, ok := reg.entries[key]; ok && current == entry {
+				close(entry.stop)
+				delete(reg.entries, key)
+			}
+			reg.mu.Unlock()
+
+			slog.Info("removed repository, which is no longer allowed", "repository", old.String())
+			continue
+		}
+
+		// Replace the definition of the repository in the stats, and register the newly configured notifiers.
+		entry.stats.setRepository(repo)
+		c.notifyRegister(entry.stats)
+
+		switch {
+		case c.reloadNeedsFetch(prev, old, repo):
+			// Re-fetch the avatar images and prepare the final images, if the sources or filters are changed.
+			if err := c.updateStats(entry.stats); err != nil {
+				slog.Error("failed to re-fetch repository", "repository", repo.String(), "details", err.Error())
+			}
+		case !reflect.DeepEqual(old.Images, repo.Images) || *c.OutputImage != *prev.OutputImage:
+			// Re-render the final images from the cached avatars, if only the visual settings are changed (the
+			// avatars of the users, who are rendered by the larger grid now, are downloaded).
+			store := c.prepareStoreImages(repo, entry.stats.store(), entry.stats.store())
+			if err := c.renderStats(entry.stats, store); err != nil {
+				slog.Error("failed to re-render repository", "repository", repo.String(), "details", err.Error())
+				continue
+			}
+			slog.Info("re-rendered final images from cached avatars", "repository", repo.String())
+		}
+
+		// Restart the updating goroutine of the repository with the new configuration (e.g., the refresh interval).
+		reg.mu.Lock()
+		if current, ok := reg.entries[key]; ok && current == entry {
+			close(entry.stop)
+			entry.stop = make(chan struct{})
+			entry.pinned = c.isDefault(repo.Owner, repo.Name) || c.isDeclared(repo.Owner, repo.Name) != nil
+			go c.updateFinalImage(entry.stats, entry.stop)
+		}
+		reg.mu.Unlock()
+	}
+
+	// Fetch the default and declared repositories, which are not in the registry yet.
+	for _, repo := range append([]*repository{c.Repository}, c.Repositories.Declared...) {
+		if _, err := c.registryGet(reg, repo.Owner, repo.Name, 0); err != nil {
+			slog.Error("failed to prepare repository", "repository", repo.String(), "details", err.Error())
+		}
+	}
+}
+
+// reloadNeedsFetch checks, if the given new definition of the repository needs
+// to re-fetch the avatar images: the GitHub API settings, the sources of its
+// images, or the filters and order of any image are changed.
+func (c *Config) reloadNeedsFetch(prev *Config, old, repo *repository) bool {
+	// Check the settings of the GitHub API.
+	if c.GithubToken != prev.GithubToken || c.GithubMaxPages != prev.GithubMaxPages {
+		return true
+	}
+
+	// Check the sources of the images, and the newest order of the stargazers (the last pages are fetched for it).
+	for _, source := range []string{"stargazers", "contributors"} {
+		if old.usesSource(source) != repo.usesSource(source) {
+			return true
+		}
+	}
+	if old.usesOrder("stargazers", "newest") != repo.usesOrder("stargazers", "newest") {
+		return true
+	}
+
+	// Check the sources, filters and order of the images with the same name.
+	for _, def := range repo.Images {
+		if oldDef := old.image(def.Name); oldDef != nil &&
+			(oldDef.Source != def.Source || oldDef.Order != def.Order || !reflect.DeepEqual(oldDef.Filters, def.Filters)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// runRender runs the one-shot rendering with the loaded environment variables
+// and the given arguments of the "render" command: it fetches the avatar
+// images of the default repository once (or loads them from the snapshot, if
+// the "--snapshot" flag is set), and writes its final images to the output
+// directory (e.g., "./assets/stargazers.png"). It returns an error, if
+// anything fails, so the process can exit with the non-zero code.
+func runRender(args []string) error {
+	// Parse the arguments of the command.
+	flags := commandFlags("render", "Fetch the statistics once and write the images to a directory", true)
+	out := flags.String("out", ".", "directory to write the images to")
+	formats := flags.String("formats", "", "comma-separated list of formats to write (png, webp, jpg), all allowed by default")
+	snapshotPath := flags.String("snapshot", "", "path to the snapshot file or directory to render offline (see the fetch command)")
+	if err := commandParse(flags, args); err != nil {
+		return err
+	}
+
+	// Validate environment variables and create a new application.
+	app, err := validateEnvVariables()
+	if err != nil {
+		return err
+	}
+
+	// Render the final images from the snapshot with no network access, if it is set.
+	if *snapshotPath != "" {
+		stats, err := app.renderSnapshot(*snapshotPath)
+		if err != nil {
+			return err
+		}
+
+		return app.renderWrite(stats, *out, helpSplitList(*formats))
+	}
+
+	// Fetch the avatar images of the default repository, and prepare the final images (with no side effects of the
+	// server refresh, e.g., the state and the notifications).
+	store, err := app.fetchImages(app.Repository)
+	if err != nil {
+		return err
+	}
+	stats := newStats(app.Repository, app.OutputImage.CacheSize)
+	if err := app.renderStats(stats, store); err != nil {
+		return err
+	}
+
+	return app.renderWrite(stats, *out, helpSplitList(*formats))
+}
+
+// renderSnapshot loads the snapshot from the given path, and prepares the
+// final images of its repository from the avatar images of the snapshot. The
+// images of the repository are taken from the configuration (the declared
+// repository, or the images of the default repository).
+func (c *Config) renderSnapshot(path string) (*Stats, error) {
+	// Load the snapshot and decode the avatar images.
+	snap, err := loadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	store, err := snap.store()
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the repository of the snapshot.
+	owner, name, ok := strings.Cut(snap.Repository, "/")
+	if !ok {
+		return nil, fmt.Errorf("wrong repository '%s' in snapshot %s", snap.Repository, path)
+	}
+
+	// Prepare the final images from the avatar images of the snapshot.
+	stats := newStats(c.repositoryFor(owner, name), c.OutputImage.CacheSize)
+	if err := c.renderStats(stats, store); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// renderWrite writes the final images of the given stats to the given output
+// directory, one file per image and format (e.g., "stargazers.png" and
+// "stargazers.webp"). If the given list of formats is not empty, only these
+// formats are written.
+func (c *Config) renderWrite(stats *Stats, out string, formats []string) error {
+	// Create the output directory, if it does not exist.
+	if err := os.MkdirAll(filepath.Clean(out), 0o755); err != nil {
+		return err
+	}
+
+	// Select the JPEG format by its common file extension too.
+	for i, format := range formats {
+		if format == "jpg" {
+			formats[i] = "jpeg"
+		}
+	}
+
+	for _, def := range stats.repository().Images {
+		for _, format := range def.Formats {
+			// Skip the format, if it is not selected.
+			if len(formats) > 0 && !slices.Contains(formats, format) {
+				continue
+			}
+
+			// Encode the final image in the format.
+			encoded, err := c.encodedImage(stats, def, format, def.Options)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s to %s (%s)", def.Name, format, err.Error())
+			}
+
+			// Set the common file extension for the JPEG format.
+			extension := format
+			if format == "jpeg" {
+				extension = "jpg"
+			}
+
+			// Write the encoded image to the file.
+			path := filepath.Join(out, def.Name+"."+extension)
+			if err := os.WriteFile(path, encoded, 0o644); err != nil {
+				return err
+			}
+
+			slog.Info("successfully wrote final image", "path", path, "size", len(encoded))
+		}
+	}
+
+	return nil
+}
@@ -1,79 +1,565 @@
 package main
 
 import (
+	"bytes"
+	"encoding/xml"
+	"errors"
 	"fmt"
-	"image/png"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	jsoniter "github.com/json-iterator/go"
 )
 
-// runServer runs a new HTTP server with the loaded environment variables.
-func runServer() error {
+// runServer runs a new HTTP server with the loaded environment variables and
+// the given arguments of the "serve" command.
+func runServer(args []string) error {
+	// Parse the arguments of the command.
+	flags := commandFlags("serve", "Run the HTTP server", true)
+	if err := commandParse(flags, args); err != nil {
+		return err
+	}
+
 	// Validate environment variables and create a new application.
 	app, err := validateEnvVariables()
 	if err != nil {
 		return err
 	}
 
-	// Fetch URLs of the avatar images of stargazers and contributors.
-	images, err := app.fetchImages()
-	if err != nil {
-		return err
+	// Information about the application.
+	slog.Info("starting HTTP server", "port", app.Server.Port, "version", version)
+
+	// Create a new registry of the repositories.
+	registry := newRegistry()
+
+	// Fetch the avatar images of stargazers and contributors of the default and declared repositories, and prepare
+	// the final images in the background (the readiness endpoint reports ready, once the default repository is
+	// prepared). These repositories are pinned in the registry, other repositories are fetched on demand.
+	go func() {
+		for _, repo := range append([]*repository{app.Repository}, app.Repositories.Declared...) {
+			if _, err := app.registryGet(registry, repo.Owner, repo.Name, 0); err != nil {
+				slog.Error("failed to prepare repository", "repository", repo.String(), "details", err.Error())
+			}
+		}
+	}()
+
+	// Store the configuration to be replaced by the reload (on the SIGHUP signal or the change of the file).
+	current := &atomic.Pointer[Config]{}
+	current.Store(app)
+
+	// Serve the final images, snippets and JSON API for stargazers and contributors of the repositories.
+	http.HandleFunc("GET /github/{owner}/{repo}/{file}", metricsHandler(
+		"/github/{owner}/{repo}/{file}", func(w http.ResponseWriter, r *http.Request) {
+			current.Load().handleFile(registry)(w, r)
+		},
+	))
+
+	// Serve the star history charts of the repositories.
+	for _, format := range []string{"svg", "png"} {
+		pattern := "/github/{owner}/{repo}/star-history." + format
+		http.HandleFunc("GET "+pattern, metricsHandler(pattern, func(w http.ResponseWriter, r *http.Request) {
+			current.Load().handleStarHistory(registry, format)(w, r)
+		}))
 	}
 
-	// Log the number of avatar images collected.
-	slog.Info(
-		"successfully collected avatar images",
-		"stargazers", len(images.Stargazers), "contributors", len(images.Contributors),
-	)
+	// Serve the JSON API with the lost stargazers of the repositories.
+	http.HandleFunc("GET /github/{owner}/{repo}/lost-stargazers.json", metricsHandler(
+		"/github/{owner}/{repo}/lost-stargazers.json", func(w http.ResponseWriter, r *http.Request) {
+			current.Load().handleLostStargazers(registry)(w, r)
+		},
+	))
 
-	// Call prepareFinalImage with the required parameters for stargazers.
-	stargazersFinalImage, err := app.prepareFinalImage(images.Stargazers)
-	if err != nil {
+	// Serve the liveness, readiness and status endpoints.
+	http.HandleFunc("GET /healthz", metricsHandler("/healthz", handleHealth))
+	http.HandleFunc("GET /readyz", metricsHandler("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		current.Load().handleReady(registry)(w, r)
+	}))
+	http.HandleFunc("GET /status", metricsHandler("/status", func(w http.ResponseWriter, r *http.Request) {
+		current.Load().handleStatus(registry)(w, r)
+	}))
+
+	// Serve the admin API to force the refresh of one or all repositories (rate-limited for each repository).
+	limiter := newAdminLimiter()
+	http.HandleFunc("POST /admin/refresh", metricsHandler("/admin/refresh", func(w http.ResponseWriter, r *http.Request) {
+		current.Load().handleAdminRefresh(registry, limiter)(w, r)
+	}))
+	http.HandleFunc("POST /admin/refresh/{owner}/{repo}", metricsHandler(
+		"/admin/refresh/{owner}/{repo}", func(w http.ResponseWriter, r *http.Request) {
+			current.Load().handleAdminRefresh(registry, limiter)(w, r)
+		},
+	))
+
+	// Receive the events of the GitHub webhook to refresh the affected images (debounced for each repository).
+	debouncer := newWebhookDebouncer(current)
+	http.HandleFunc("POST /webhooks/github", metricsHandler("/webhooks/github", func(w http.ResponseWriter, r *http.Request) {
+		current.Load().handleWebhook(registry, debouncer)(w, r)
+	}))
+
+	// Serve the metrics in the Prometheus text format.
+	http.HandleFunc("GET /metrics", metricsHandler("/metrics", handleMetrics(registry)))
+
+	// Start a goroutine to reload the configuration.
+	go reloadWatch(current, registry)
+
+	// Start a goroutine to evict the unused repositories from the registry.
+	go app.registryEvict(registry)
+
+	// Create a new server instance with options from environment variables.
+	// For more information, see https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.Server.Port),
+		ReadTimeout:  time.Duration(app.Server.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(app.Server.WriteTimeout) * time.Second,
+	}
+
+	// Create a channel to receive the SIGINT and SIGTERM signals.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// Start the server in a separate goroutine.
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.ListenAndServe()
+	}()
+
+	// Wait for the error of the server or the signal to shut it down.
+	select {
+	case err := <-errChan:
 		return err
+	case sig := <-signals:
+		slog.Info("received signal, shutting down HTTP server", "signal", sig.String())
+	}
+
+	return current.Load().shutdownServer(server, registry)
+}
+
+// handleFile returns an HTTP handler, which serves the requested file (e.g.,
+// "stargazers.png", "contributors@2x.webp" or "stargazers.json") of the
+// requested repository by its name. The name of the file must match one of the
+// images defined for the repository, with one of its allowed formats.
+func (c *Config) handleFile(reg *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the name of the requested file.
+		file, err := helpParseFileName(r.PathValue("file"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		// Get the definition of the requested image of the repository, and check its allowed formats.
+		def := c.repositoryFor(r.PathValue("owner"), r.PathValue("repo")).image(file.Name)
+		if def == nil || !def.allowsFormat(file.Format) {
+			http.Error(w, fmt.Sprintf("unknown file '%s'", r.PathValue("file")), http.StatusNotFound)
+			return
+		}
+
+		// Get the stats of the requested repository from the registry (or wait for the fetch of the cold one).
+		s, err := c.registryGet(
+			reg, r.PathValue("owner"), r.PathValue("repo"), time.Duration(c.Repositories.FetchTimeout)*time.Second,
+		)
+		if err != nil {
+			if errors.Is(err, errRepositoryNotAllowed) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errFlightTimeout) {
+				c.handlePlaceholder(def, file)(w, r)
+				return
+			}
+			slog.Error("failed to prepare repository", "details", err.Error())
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		switch file.Format {
+		case "md":
+			// Serve the Markdown snippet with clickable avatars.
+			c.handleSnippet(s, def, "text/markdown")(w, r)
+		case "html":
+			// Serve the HTML snippet with clickable avatars.
+			c.handleSnippet(s, def, "text/html")(w, r)
+		case "json":
+			// Serve the JSON API with the users behind the final image.
+			c.handleAPI(s, def)(w, r)
+		case "atom":
+			// Serve the Atom feed with the new users of the image.
+			c.handleFeed(s, def)(w, r)
+		default:
+			// Serve the final image.
+			c.handleFinalImage(s, def, file.Format, file.Scale)(w, r)
+		}
+	}
+}
+
+// handlePlaceholder returns an HTTP handler, which serves the placeholder for
+// the requested file of the given image, while the repository is still
+// fetching. The images get a placeholder image, other files get the 503
+// Service Unavailable status. Both are not cached by the clients.
+func (c *Config) handlePlaceholder(def *imageDefinition, file requestedFile) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+		// Serve the 503 status with the Retry-After header for the snippets and JSON API.
+		if file.Format == "md" || file.Format == "html" || file.Format == "json" || file.Format == "atom" {
+			w.Header().Set("Retry-After", strconv.Itoa(c.Repositories.FetchTimeout))
+			http.Error(w, "repository is not fetched yet, try again later", http.StatusServiceUnavailable)
+			return
+		}
+
+		// Select the format by the Accept header, if it is not set.
+		format := file.Format
+		if format == "" {
+			w.Header().Set("Vary", "Accept")
+			format = encodeNegotiateFormat(r.Header.Get("Accept"), def.Formats)
+		}
+
+		// Parse the render options from the query.
+		options, err := prepareRenderOptions(def.Options, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Set the scale factor from the file name, if it exists.
+		if file.Scale != 0 {
+			options.Scale = file.Scale
+		}
+
+		// Check the size of the custom variant of the image.
+		if options != def.Options {
+			if err := prepareRenderSize(options); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Encode the placeholder image in the selected format.
+		var buf bytes.Buffer
+		if err := c.encodeImage(&buf, makeImagePlaceholder(options), format); err != nil {
+			slog.Error("encode to "+imageContentTypes[format], "details", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", imageContentTypes[format])
+		if _, err := buf.WriteTo(w); err != nil {
+			slog.Error("write placeholder image", "details", err.Error())
+			return
+		}
+	}
+}
+
+// handleFinalImage returns an HTTP handler, which serves the final image of
+// the given definition in the given format with the given scale factor.
+//
+// If the format is empty, it is selected by the Accept header of the request.
+// The render options are set by the query parameters (see the
+// prepareRenderOptions function) over the options of the image. If the scale
+// factor is not 0, it overrides the "scale" query parameter.
+func (c *Config) handleFinalImage(s *Stats, def *imageDefinition, format string, scale int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Select the format by the Accept header, if it is not set.
+		if format == "" {
+			w.Header().Set("Vary", "Accept")
+			format = encodeNegotiateFormat(r.Header.Get("Accept"), def.Formats)
+		}
+
+		// Parse the render options from the query.
+		options, err := prepareRenderOptions(def.Options, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Set the scale factor from the file name, if it exists.
+		if scale != 0 {
+			options.Scale = scale
+		}
+
+		// Check the size of the custom variant of the image.
+		if options != def.Options {
+			if err := prepareRenderSize(options); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Render (if needed) and encode the final image in the selected format.
+		encoded, err := c.encodedImage(s, def, format, options)
+		if err != nil {
+			slog.Error("encode to "+imageContentTypes[format], "details", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", imageContentTypes[format])
+		if _, err := w.Write(encoded); err != nil {
+			slog.Error("write final image", "details", err.Error())
+			return
+		}
+	}
+}
+
+// handleSnippet returns an HTTP handler, which serves the Markdown/HTML
+// snippet with clickable avatars for the users of the given image. The layout of
+// the snippet can be set by the "layout" query parameter ("flow" or "table"),
+// and the users and sizes follow the same render options as the final image.
+func (c *Config) handleSnippet(s *Stats, def *imageDefinition, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the render options from the query.
+		options, err := prepareRenderOptions(def.Options, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", fmt.Sprintf("%s; charset=utf-8", contentType))
+		if _, err := fmt.Fprint(w, makeSnippet(s.avatars(def.Name), r.URL.Query().Get("layout"), options)); err != nil {
+			slog.Error("write snippet", "details", err.Error())
+			return
+		}
+	}
+}
+
+// handleAPI returns an HTTP handler, which serves the JSON API with the users
+// behind the final image of the given definition. The page of the users
+// can be set by the "page" and "per_page" query parameters.
+func (c *Config) handleAPI(s *Stats, def *imageDefinition) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the pagination parameters from the query.
+		page, perPage, err := makeAPIPagination(r.URL.Query().Get("page"), r.URL.Query().Get("per_page"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Parse the render options from the query.
+		options, err := prepareRenderOptions(def.Options, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Make the response with the users from the stats.
+		response := makeAPIResponse(s.avatars(def.Name), s.lastUpdate(), page, perPage, options)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w).Encode(response); err != nil {
+			slog.Error("encode to application/json", "details", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// handleFeed returns an HTTP handler, which serves the Atom feed with the new
+// users of the given image (the new stargazers or the first-time contributors)
+// from the history of the changes of the repository.
+func (c *Config) handleFeed(s *Stats, def *imageDefinition) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Build the "self" link of the feed from the request (behind the proxy, the scheme is in the X-Forwarded-Proto
+		// header). The IDs of the feed and its entries never depend on it.
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		self := fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.Path)
+
+		// Make the feed with the history of the stats.
+		feed := makeFeed(s.history(), s.repository(), def, self, s.lastUpdate())
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			slog.Error("write feed", "details", err.Error())
+			return
+		}
+		if err := xml.NewEncoder(w).Encode(feed); err != nil {
+			slog.Error("encode to application/atom+xml", "details", err.Error())
+			return
+		}
 	}
+}
 
-	// Call prepareFinalImage with the required parameters for contributors.
-	contributorsFinalImage, err := app.prepareFinalImage(images.Contributors)
+// handleRepositoryStats gets the stats of the requested repository from the
+// registry (or waits for the fetch of the cold one). If it fails, the error is
+// served (the 503 Service Unavailable status with the Retry-After header, while
+// the repository is still fetching), and it returns false.
+func (c *Config) handleRepositoryStats(reg *Registry, w http.ResponseWriter, r *http.Request) (*Stats, bool) {
+	s, err := c.registryGet(
+		reg, r.PathValue("owner"), r.PathValue("repo"), time.Duration(c.Repositories.FetchTimeout)*time.Second,
+	)
 	if err != nil {
-		return err
+		if errors.Is(err, errRepositoryNotAllowed) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return nil, false
+		}
+		if errors.Is(err, errFlightTimeout) {
+			w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+			w.Header().Set("Retry-After", strconv.Itoa(c.Repositories.FetchTimeout))
+			http.Error(w, "repository is not fetched yet, try again later", http.StatusServiceUnavailable)
+			return nil, false
+		}
+		slog.Error("failed to prepare repository", "details", err.Error())
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return nil, false
 	}
 
-	// Create endpoints URLs for stargazers and contributors.
-	stargazersEndpoint := fmt.Sprintf("/github/%s/%s/stargazers.png", app.Repository.Owner, app.Repository.Name)
-	contributorsEndpoint := fmt.Sprintf("/github/%s/%s/contributors.png", app.Repository.Owner, app.Repository.Name)
+	return s, true
+}
+
+// handleStarHistory returns an HTTP handler, which serves the star history
+// chart of the requested repository in the given format ("svg" or "png"). The
+// options of the chart are set by the query parameters (see the
+// prepareChartOptions function) over the STAR_HISTORY_* ones. The star history
+// is tracked for the repositories with the image of the stargazers only.
+func (c *Config) handleStarHistory(reg *Registry, format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the chart options from the query.
+		options, err := prepareChartOptions(c.defaultChartOptions(), r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	// Serve the final image for stargazers using an HTTP server.
-	http.HandleFunc(stargazersEndpoint, func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "image/png")
-		if err := png.Encode(w, stargazersFinalImage); err != nil {
-			slog.Error("encode to image/png", "details", err.Error())
+		// Check, if the star history of the requested repository is tracked.
+		if !c.repositoryFor(r.PathValue("owner"), r.PathValue("repo")).usesSource("stargazers") {
+			http.Error(w, "star history is not tracked for the repository without stargazers", http.StatusNotFound)
+			return
+		}
+
+		// Get the stats of the requested repository from the registry (or wait for the fetch of the cold one).
+		s, ok := c.handleRepositoryStats(reg, w, r)
+		if !ok {
+			return
+		}
+
+		// Draw (if needed) and encode the chart in the given format.
+		encoded, err := c.encodedStarHistory(s, format, options)
+		if err != nil {
+			slog.Error("draw star history", "details", err.Error())
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-	})
 
-	// Serve the final image for contributors using an HTTP server.
-	http.HandleFunc(contributorsEndpoint, func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "image/png")
-		if err := png.Encode(w, contributorsFinalImage); err != nil {
-			slog.Error("encode to image/png", "details", err.Error())
+		contentType := imageContentTypes["png"]
+		if format == "svg" {
+			contentType = "image/svg+xml"
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		if _, err := w.Write(encoded); err != nil {
+			slog.Error("write star history", "details", err.Error())
+			return
+		}
+	}
+}
+
+// handleLostStargazers returns an HTTP handler, which serves the JSON API with
+// the lost stargazers (the unstars) of the requested repository, from the
+// newest one. The page of the users can be set by the "page" and "per_page"
+// query parameters, and the time range of the churn by the "range" query
+// parameter ("30d" by default, or "all"). The unstars are tracked for the
+// repositories with the image of the stargazers only.
+func (c *Config) handleLostStargazers(reg *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the pagination parameters from the query.
+		page, perPage, err := makeAPIPagination(r.URL.Query().Get("page"), r.URL.Query().Get("per_page"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Parse the time range of the churn from the query.
+		churnRange := r.URL.Query().Get("range")
+		if churnRange == "" {
+			churnRange = "30d"
+		}
+		if _, err := helpParseRange(churnRange); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Check, if the lost stargazers of the requested repository are tracked.
+		if !c.repositoryFor(r.PathValue("owner"), r.PathValue("repo")).usesSource("stargazers") {
+			http.Error(w, "lost stargazers are not tracked for the repository without stargazers", http.StatusNotFound)
+			return
+		}
+
+		// Get the stats of the requested repository from the registry (or wait for the fetch of the cold one).
+		s, ok := c.handleRepositoryStats(reg, w, r)
+		if !ok {
+			return
+		}
+
+		// Make the response with the lost stargazers from the stats.
+		response, err := makeLostAPIResponse(s.lostStargazers(), s.lastUpdate(), page, perPage, churnRange)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w).Encode(response); err != nil {
+			slog.Error("encode to application/json", "details", err.Error())
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-	})
+	}
+}
 
-	// Start a goroutine to continuously update the final images.
-	go app.updateFinalImage(stargazersFinalImage, contributorsFinalImage)
+// handleHealth serves the liveness endpoint: the application is alive, if it
+// responds at all.
+func handleHealth(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if _, err := fmt.Fprintln(w, "ok"); err != nil {
+		slog.Error("write health", "details", err.Error())
+		return
+	}
+}
 
-	// Create a new server instance with options from environment variables.
-	// For more information, see https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.Server.Port),
-		ReadTimeout:  time.Duration(app.Server.ReadTimeout) * time.Second,
-		WriteTimeout: time.Duration(app.Server.WriteTimeout) * time.Second,
+// handleReady returns an HTTP handler, which serves the readiness endpoint:
+// the 200 OK status, once the first snapshot of the default repository exists
+// (fetched or restored from the state directory), and the 503 Service
+// Unavailable status before that.
+func (c *Config) handleReady(reg *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+		// Serve the 503 status, if the default repository is not prepared yet.
+		if !c.isReady(reg) {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := fmt.Fprintln(w, "ready"); err != nil {
+			slog.Error("write readiness", "details", err.Error())
+			return
+		}
 	}
+}
 
-	return server.ListenAndServe()
+// handleStatus returns an HTTP handler, which serves the JSON status of the
+// repositories in the registry: the last refresh, the last error, the number
+// of users of each image, the next scheduled refresh and the last known rate
+// limit of the GitHub API.
+func (c *Config) handleStatus(reg *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		w.Header().Set("Content-Type", "application/json")
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w).Encode(c.makeStatusResponse(reg)); err != nil {
+			slog.Error("encode to application/json", "details", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 }
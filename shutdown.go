@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// shutdownContext is canceled, when the application is shutting down, so the
+// running updates of the repositories stop their requests to the GitHub API.
+var shutdownContext, shutdownCancel = context.WithCancel(context.Background())
+
+// shutdownUpdates is held (shared) by each running update of the stats, and
+// exclusively by the shutdown, so the state is saved after the running updates
+// are stopped.
+var shutdownUpdates sync.RWMutex
+
+// shutdownServer gracefully shuts down the given server and the repositories
+// of the given registry:
+//
+//  1. The server stops accepting new connections, and the in-flight requests
+//     are drained for SERVER_SHUTDOWN_TIMEOUT seconds.
+//  2. The running updates of the repositories are canceled, and their updating
+//     goroutines are stopped.
+//  3. The last good state of each repository is saved to the STATE_DIR, if it
+//     is set.
+func (c *Config) shutdownServer(server *http.Server, reg *Registry) error {
+	// Drain the in-flight requests with the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.Server.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("in-flight requests were not drained before the deadline", "timeout", c.Server.ShutdownTimeout)
+		err = server.Close()
+	}
+
+	// Cancel the running updates and wait for them to stop (the lock is never released, so no update starts again).
+	shutdownCancel()
+	shutdownUpdates.Lock()
+
+	// Stop the updating goroutines and remove the repositories from the registry.
+	reg.mu.Lock()
+	entries := reg.entries
+	reg.entries = make(map[string]*registryEntry)
+	for _, entry := range entries {
+		close(entry.stop)
+	}
+	reg.mu.Unlock()
+
+	// Save the last good state of each repository, which was updated at least once.
+	for _, entry := range entries {
+		if entry.stats.lastUpdate().IsZero() {
+			continue
+		}
+		if err := c.stateSave(entry.stats); err != nil {
+			slog.Error("failed to save state", "repository", entry.stats.repository().String(), "details", err.Error())
+		}
+	}
+
+	slog.Info("successfully shut down HTTP server", "repositories", len(entries))
+
+	return err
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// snapshotFile is the name of the snapshot file in the snapshot directory.
+const snapshotFile = "snapshot.json"
+
+// snapshot represents the portable snapshot of the fetched users of the
+// repository: the stargazers and contributors in the same order as they were
+// returned by the GitHub API, and optionally their avatar images, so the
+// final images can be rendered from the snapshot with no network access. The
+// complete flags and the max number of pages tell, if the lists were fetched
+// up to their last page (see the ImageStore struct).
+type snapshot struct {
+	Repository           string         `json:"repository"`
+	FetchedAt            time.Time      `json:"fetched_at"`
+	MaxPages             int            `json:"max_pages,omitempty"`
+	StargazersComplete   bool           `json:"stargazers_complete,omitempty"`
+	ContributorsComplete bool           `json:"contributors_complete,omitempty"`
+	Stargazers           []snapshotUser `json:"stargazers"`
+	Contributors         []snapshotUser `json:"contributors"`
+}
+
+// snapshotUser represents the user in the snapshot. The avatar image (in the
+// PNG format) is embedded in the snapshot file, or saved to the separate file
+// of the snapshot directory.
+type snapshotUser struct {
+	Login         string     `json:"login"`
+	Type          string     `json:"type,omitempty"`
+	AvatarURL     string     `json:"avatar_url"`
+	ProfileURL    string     `json:"profile_url"`
+	Contributions int        `json:"contributions,omitempty"`
+	StarredAt     *time.Time `json:"starred_at,omitempty"`
+	Avatar        []byte     `json:"avatar,omitempty"`
+	AvatarFile    string     `json:"avatar_file,omitempty"`
+}
+
+// runFetch runs the "fetch" command with the loaded environment variables and
+// the given arguments: it fetches the users of the default repository once,
+// and dumps them to the snapshot (or to the standard output, if the "--dump"
+// flag is not set).
+//
+// The snapshot is written to the single JSON file, if the path has the ".json"
+// extension, or to the directory with the "snapshot.json" file and the
+// "avatars" subdirectory otherwise. The avatar images are added to the
+// snapshot, if the "--avatars" flag is set.
+func runFetch(args []string) error {
+	// Parse the arguments of the command.
+	flags := commandFlags("fetch", "Fetch the statistics once and dump the users to a snapshot", true)
+	dump := flags.String("dump", "", "path to the snapshot file (.json) or directory to write (the standard output by default)")
+	withAvatars := flags.Bool("avatars", false, "add the avatar images to the snapshot to render it offline")
+	if err := commandParse(flags, args); err != nil {
+		return err
+	}
+
+	// Validate environment variables and create a new application.
+	app, err := validateEnvVariables()
+	if err != nil {
+		return err
+	}
+
+	// Fetch the users of the default repository (with the avatar images, if they are needed).
+	fetch := app.fetchUsersStore
+	if *withAvatars {
+		fetch = app.fetchImages
+	}
+	store, err := fetch(app.Repository)
+	if err != nil {
+		return err
+	}
+
+	// Create a snapshot from the fetched users.
+	snap, err := makeSnapshot(app.Repository, store, *withAvatars)
+	if err != nil {
+		return err
+	}
+
+	// Write the snapshot to the standard output, if the path is not set.
+	if *dump == "" {
+		return writeSnapshot(os.Stdout, snap)
+	}
+
+	// Write the snapshot to the file or directory.
+	if err := saveSnapshot(*dump, snap); err != nil {
+		return err
+	}
+
+	slog.Info(
+		"successfully dumped snapshot",
+		"path", *dump, "stargazers", len(snap.Stargazers), "contributors", len(snap.Contributors),
+	)
+
+	return nil
+}
+
+// makeSnapshot creates a snapshot of the given repository from the users of
+// the given store. If the withAvatars argument is true, the avatar images are
+// encoded to the PNG format and added to the snapshot.
+func makeSnapshot(repo *repository, store ImageStore, withAvatars bool) (snapshot, error) {
+	// Create a function to convert the users to the users of the snapshot.
+	convert := func(avatars []UserAvatar) ([]snapshotUser, error) {
+		users := make([]snapshotUser, 0, len(avatars))
+		for _, avatar := range avatars {
+			user := snapshotUser{
+				Login:         avatar.Login,
+				Type:          avatar.Type,
+				AvatarURL:     avatar.URL,
+				ProfileURL:    avatar.ProfileURL,
+				Contributions: avatar.Contributions,
+			}
+
+			// Set the time of starring, if it exists.
+			if !avatar.StarredAt.IsZero() {
+				starredAt := avatar.StarredAt
+				user.StarredAt = &starredAt
+			}
+
+			// Encode the avatar image, if needed.
+			if withAvatars && avatar.Image != nil {
+				var buf bytes.Buffer
+				if err := png.Encode(&buf, avatar.Image); err != nil {
+					return nil, err
+				}
+				user.Avatar = buf.Bytes()
+			}
+
+			users = append(users, user)
+		}
+		return users, nil
+	}
+
+	// Convert the stargazers and contributors.
+	stargazers, err := convert(store.Stargazers)
+	if err != nil {
+		return snapshot{}, err
+	}
+	contributors, err := convert(store.Contributors)
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	return snapshot{
+		Repository:           repo.String(),
+		FetchedAt:            time.Now().UTC(),
+		MaxPages:             store.MaxPages,
+		StargazersComplete:   store.StargazersComplete,
+		ContributorsComplete: store.ContributorsComplete,
+		Stargazers:           stargazers,
+		Contributors:         contributors,
+	}, nil
+}
+
+// writeSnapshot writes the given snapshot to the given writer in the indented
+// JSON format.
+func writeSnapshot(w io.Writer, snap snapshot) error {
+	// Create a new JSON encoder with the indentation for the readable diffs.
+	encoder := jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(snap)
+}
+
+// saveSnapshot saves the given snapshot to the given path: to the single JSON
+// file (with the embedded avatar images), if the path has the ".json"
+// extension, or to the directory with the "snapshot.json" file and the
+// avatar images in the "avatars" subdirectory otherwise.
+func saveSnapshot(path string, snap snapshot) error {
+	// Clean the given path.
+	path = filepath.Clean(path)
+
+	// Save the avatar images to the separate files, if the path is a directory.
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		// Create the directory for the avatar images.
+		if err := os.MkdirAll(filepath.Join(path, "avatars"), 0o755); err != nil {
+			return err
+		}
+
+		// Move the avatar images of the users from the snapshot to the files.
+		for _, users := range [][]snapshotUser{snap.Stargazers, snap.Contributors} {
+			for i := range users {
+				if users[i].Avatar == nil {
+					continue
+				}
+
+				users[i].AvatarFile = filepath.ToSlash(filepath.Join("avatars", users[i].Login+".png"))
+				if err := os.WriteFile(filepath.Join(path, users[i].AvatarFile), users[i].Avatar, 0o644); err != nil {
+					return err
+				}
+				users[i].Avatar = nil
+			}
+		}
+
+		// Set the path to the snapshot file in the directory.
+		path = filepath.Join(path, snapshotFile)
+	}
+
+	// Create the snapshot file and write the snapshot to it.
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeSnapshot(file, snap); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// loadSnapshot loads the snapshot from the given path: from the single JSON
+// file, or from the directory with the "snapshot.json" file. The avatar images
+// from the separate files of the directory are loaded to the snapshot.
+func loadSnapshot(path string) (snapshot, error) {
+	// Clean the given path.
+	path = filepath.Clean(path)
+
+	// Set the path to the snapshot file, if the path is a directory.
+	dir := ""
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		dir, path = path, filepath.Join(path, snapshotFile)
+	}
+
+	// Read the snapshot file.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	// Decode the snapshot file.
+	snap := snapshot{}
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, &snap); err != nil {
+		return snapshot{}, fmt.Errorf("failed to decode snapshot %s (%s)", path, err.Error())
+	}
+
+	// Load the avatar images of the users from the separate files, if they exist.
+	for _, users := range [][]snapshotUser{snap.Stargazers, snap.Contributors} {
+		for i := range users {
+			if users[i].AvatarFile == "" || dir == "" {
+				continue
+			}
+
+			users[i].Avatar, err = os.ReadFile(filepath.Join(dir, filepath.Clean("/"+users[i].AvatarFile)))
+			if err != nil {
+				return snapshot{}, err
+			}
+		}
+	}
+
+	return snap, nil
+}
+
+// store returns the store of the avatar images from the snapshot with the
+// decoded avatar images (the users without the avatar images are not
+// rendered). It returns an error, if no user has the avatar image in the
+// snapshot (the snapshot was dumped without the "--avatars" flag).
+func (snap snapshot) store() (ImageStore, error) {
+	// Count the users with the avatar images.
+	withAvatars := 0
+	// Create a function to convert the users of the snapshot to the users.
+	convert := func(users []snapshotUser) ([]UserAvatar, error) {
+		avatars := make([]UserAvatar, 0, len(users))
+		for _, user := range users {
+			avatar := UserAvatar{
+				Login:         user.Login,
+				Type:          user.Type,
+				URL:           user.AvatarURL,
+				ProfileURL:    user.ProfileURL,
+				Contributions: user.Contributions,
+			}
+
+			// Set the time of starring, if it exists.
+			if user.StarredAt != nil {
+				avatar.StarredAt = *user.StarredAt
+			}
+
+			// Decode the avatar image, if it exists.
+			if user.Avatar != nil {
+				img, _, err := image.Decode(bytes.NewReader(user.Avatar))
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode avatar image of user %s (%s)", user.Login, err.Error())
+				}
+				avatar.Image = img
+				withAvatars++
+			}
+
+			avatars = append(avatars, avatar)
+		}
+		return avatars, nil
+	}
+
+	// Convert the stargazers and contributors.
+	stargazers, err := convert(snap.Stargazers)
+	if err != nil {
+		return ImageStore{}, err
+	}
+	contributors, err := convert(snap.Contributors)
+	if err != nil {
+		return ImageStore{}, err
+	}
+
+	// Check, if the snapshot has the avatar images.
+	if withAvatars == 0 && len(stargazers)+len(contributors) > 0 {
+		return ImageStore{}, fmt.Errorf("snapshot has no avatar images (dump it with --avatars)")
+	}
+
+	return ImageStore{
+		Stargazers:           stargazers,
+		Contributors:         contributors,
+		StargazersComplete:   snap.StargazersComplete,
+		ContributorsComplete: snap.ContributorsComplete,
+		MaxPages:             snap.MaxPages,
+	}, nil
+}
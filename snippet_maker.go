@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// makeSnippet makes a ready-to-paste Markdown/HTML block with the clickable
+// avatars of the given users. Each avatar is linked to the user's profile.
+//
+// The layout argument sets the layout of the block: "table" makes a table with
+// the same number of avatars per row as the final image, any other value makes
+// a simple flow of avatars. The users and sizes of the avatars are set by the
+// given render options.
+func makeSnippet(avatars []UserAvatar, layout string, o renderOptions) string {
+	// Set the users, which are shown on the final image.
+	avatars = prepareVisibleAvatars(avatars, o)
+
+	// Calculate the grid size of the final image.
+	perRow, _ := prepareGridSize(len(avatars), o)
+
+	// Create a new string builder for the snippet.
+	var b strings.Builder
+
+	if layout == "table" {
+		// Make a table with the avatars.
+		b.WriteString("<table>\n")
+		for i, avatar := range avatars {
+			// Open a new row for the first avatar in the row.
+			if i%perRow == 0 {
+				b.WriteString("  <tr>\n")
+			}
+
+			// Write a cell with the clickable avatar.
+			fmt.Fprintf(&b, "    <td align=\"center\">%s</td>\n", makeSnippetItem(avatar, o.Size))
+
+			// Close the row for the last avatar in the row (or the last avatar at all).
+			if i%perRow == perRow-1 || i == len(avatars)-1 {
+				b.WriteString("  </tr>\n")
+			}
+		}
+		b.WriteString("</table>\n")
+
+		return b.String()
+	}
+
+	// Make a flow of the avatars.
+	b.WriteString("<p>\n")
+	for _, avatar := range avatars {
+		// Write the clickable avatar.
+		fmt.Fprintf(&b, "  %s\n", makeSnippetItem(avatar, o.Size))
+	}
+	b.WriteString("</p>\n")
+
+	return b.String()
+}
+
+// makeSnippetItem makes a clickable avatar of the given user with the given
+// size for the snippet.
+func makeSnippetItem(avatar UserAvatar, size int) string {
+	// Escape the user's data for the HTML.
+	login := html.EscapeString(avatar.Login)
+	profileURL := html.EscapeString(avatar.ProfileURL)
+	avatarURL := html.EscapeString(avatar.URL)
+
+	return fmt.Sprintf(
+		"<a href=\"%s\" title=\"%s\"><img src=\"%s\" width=\"%d\" height=\"%d\" alt=\"%s\"/></a>",
+		profileURL, login, avatarURL, size, size, login,
+	)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// starHistoryFile is the name of the file with the star history in the state
+// directory of the repository.
+const starHistoryFile = "star-history.json"
+
+// starHistoryMaxPoints is the max number of the points of the line of the star
+// history chart (the points are downsampled to fit).
+const starHistoryMaxPoints = 1000
+
+// starSample represents the number of the stargazers of the repository at the
+// given time. The gap flag is set for the point of the star history, which is
+// reached from the previous one by the unknown range (see the points method).
+type starSample struct {
+	At    time.Time `json:"at"`
+	Count int       `json:"count"`
+	Gap   bool      `json:"-"`
+}
+
+// starTimeline represents the star history of the repository: the time of
+// starring of each known stargazer (with the ones backfilled from the GitHub
+// API), and the total number of the stargazers sampled on each refresh. The
+// GitHub API lists the stargazers from the oldest one, so the times of
+// starring cover the start of the history, and the samples cover the rest.
+type starTimeline struct {
+	Starred    map[string]time.Time `json:"starred"`
+	Samples    []starSample         `json:"samples"`
+	Backfilled bool                 `json:"backfilled"`
+}
+
+// newStarTimeline creates a new empty starTimeline.
+func newStarTimeline() starTimeline {
+	return starTimeline{Starred: make(map[string]time.Time), Samples: make([]starSample, 0)}
+}
+
+// addStarred remembers the time of starring of the given users (the users
+// without it are skipped).
+func (t *starTimeline) addStarred(users []UserAvatar) {
+	for _, user := range users {
+		if !user.StarredAt.IsZero() {
+			t.Starred[user.Login] = user.StarredAt.UTC()
+		}
+	}
+}
+
+// addSample adds the given number of the stargazers at the given time. If the
+// number is not changed since the two last samples, the last sample is moved
+// to the given time instead, so the flat parts of the history take two
+// samples only.
+func (t *starTimeline) addSample(at time.Time, count int) {
+	sample := starSample{At: at.UTC(), Count: count}
+	if n := len(t.Samples); n >= 2 && t.Samples[n-1].Count == count && t.Samples[n-2].Count == count {
+		t.Samples[n-1] = sample
+		return
+	}
+
+	t.Samples = append(t.Samples, sample)
+}
+
+// points returns the points of the star history from the given time to the
+// given one (from the first known star, if the given from time is zero).
+//
+// The times of starring and the samples are merged by time: each time of
+// starring adds one star to the last known number, and each sample sets the
+// number. The first point is the number at the from time (or zero before the
+// first star), the last point is the number at the to time, and the points
+// are downsampled to starHistoryMaxPoints at most.
+//
+// If the first sample has more stars than the known times of starring before
+// it (e.g., the backfill is not finished, or its pages are not enough), the
+// times of the stars between them are unknown, so the point of the first
+// sample is marked as the gap.
+func (t starTimeline) points(from, to time.Time) []starSample {
+	// Merge the times of starring (with the -1 count) and the samples by time.
+	events := make([]starSample, 0, len(t.Starred)+len(t.Samples))
+	for _, at := range t.Starred {
+		events = append(events, starSample{At: at, Count: -1})
+	}
+	events = append(events, t.Samples...)
+	slices.SortStableFunc(events, func(a, b starSample) int { return a.At.Compare(b.At) })
+
+	// Return no points, if the history is empty.
+	if len(events) == 0 {
+		return make([]starSample, 0)
+	}
+
+	// Start at the first event, if the from time is not set.
+	if from.IsZero() || from.Before(events[0].At) {
+		from = events[0].At
+	}
+
+	// Count the stars of each event, and collect the points within the range.
+	points := make([]starSample, 0, len(events)+2)
+	count, sampled := 0, false
+	for _, event := range events {
+		gap := false
+		if event.Count < 0 {
+			count++
+		} else {
+			gap = !sampled && event.Count > count
+			count, sampled = event.Count, true
+		}
+
+		switch {
+		case event.At.After(to):
+			continue
+		case event.At.After(from):
+			points = append(points, starSample{At: event.At, Count: count, Gap: gap && len(points) > 0})
+		default:
+			// Move the start point to the number at the from time.
+			points = append(points[:0], starSample{At: from, Count: count})
+		}
+	}
+
+	// Start with zero stars before the first star, if the history is not clipped.
+	if len(points) > 0 && points[0].At.Equal(events[0].At) && events[0].Count < 0 {
+		points = slices.Insert(points, 0, starSample{At: from, Count: 0})
+	}
+
+	// End at the number at the to time.
+	if len(points) > 0 && points[len(points)-1].At.Before(to) {
+		points = append(points, starSample{At: to, Count: points[len(points)-1].Count})
+	}
+
+	return starDownsample(points, starHistoryMaxPoints)
+}
+
+// starDownsample returns the given points with the given max number of the
+// points at most: every N-th point is kept, with the first and the last ones.
+// The gap points and the points before them are kept too, so the unknown
+// range stays in place.
+func starDownsample(points []starSample, limit int) []starSample {
+	if len(points) <= limit {
+		return points
+	}
+
+	step := (len(points) + limit - 2) / (limit - 1)
+	sampled := make([]starSample, 0, limit+2)
+	for index := 0; index < len(points)-1; index++ {
+		if index%step == 0 || points[index].Gap || points[index+1].Gap {
+			sampled = append(sampled, points[index])
+		}
+	}
+
+	return append(sampled, points[len(points)-1])
+}
+
+// starTimeline returns a copy of the star history of the stats.
+func (s *Stats) starTimeline() starTimeline {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return starTimeline{
+		Starred:    maps.Clone(s.Stars.Starred),
+		Samples:    slices.Clone(s.Stars.Samples),
+		Backfilled: s.Stars.Backfilled,
+	}
+}
+
+// setStarTimeline replaces the star history of the stats.
+func (s *Stats) setStarTimeline(timeline starTimeline) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Stars = timeline
+}
+
+// updateStars changes the star history of the stats in place by the given
+// function, so the concurrent changes (e.g., of the refresh and the backfill)
+// are not lost. The cache of the encoded images is purged, so the charts are
+// drawn again.
+func (s *Stats) updateStars(change func(timeline *starTimeline)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change(&s.Stars)
+	s.encoded.purge()
+}
+
+// updateStarTimeline adds the given (fetched) stargazers and the current total
+// number of the stargazers of the repository to the star history of the given
+// stats.
+//
+// The stargazers are backfilled once with the STAR_HISTORY_BACKFILL_PAGES pages
+// of the GitHub API (with the star+json media type), so the history starts with
+// the first stargazer, not with the first refresh. The backfill runs in the
+// background (see the backfillStarTimeline function), so it does not delay the
+// refresh. The failed backfill and the failed count are logged and tried again
+// on the next refresh.
+func (c *Config) updateStarTimeline(stats *Stats, stargazers []UserAvatar) {
+	repo := stats.repository()
+
+	// Backfill the times of starring, if they are not backfilled yet (the fetched pages are enough, if the backfill
+	// has no more pages).
+	if !stats.starTimeline().Backfilled {
+		if c.StarHistory.BackfillPages > c.GithubMaxPages {
+			if stats.backfilling.CompareAndSwap(false, true) {
+				go c.backfillStarTimeline(stats)
+			}
+		} else {
+			stats.updateStars(func(timeline *starTimeline) { timeline.Backfilled = true })
+		}
+	}
+
+	// Sample the total number of the stargazers (the fetched ones are the total, if all pages are fetched).
+	count, err := c.fetchStargazersCount(repo)
+	switch {
+	case err == nil:
+	case len(stargazers) < c.GithubMaxPages*100:
+		count, err = len(stargazers), nil
+	default:
+		slog.Warn("failed to count stargazers", "repository", repo.String(), "details", err.Error())
+	}
+
+	// Add the times of starring of the fetched stargazers, and the sample of the total number.
+	stats.updateStars(func(timeline *starTimeline) {
+		timeline.addStarred(stargazers)
+		if err == nil {
+			timeline.addSample(time.Now(), count)
+		}
+	})
+}
+
+// backfillStarTimeline runs in a separate goroutine and adds the times of
+// starring of the stargazers from the STAR_HISTORY_BACKFILL_PAGES pages of the
+// GitHub API to the star history of the given stats. Until it is finished, the
+// chart shows the stars, which are not backfilled yet, as the unknown range.
+func (c *Config) backfillStarTimeline(stats *Stats) {
+	defer stats.backfilling.Store(false)
+
+	// Fetch the stargazers with the times of starring.
+	repo := stats.repository()
+	url := fmt.Sprintf("%s/repos/%s/%s/stargazers", githubAPIURL, repo.Owner, repo.Name)
+	users, _, err := c.fetchUsers(url, true, c.StarHistory.BackfillPages, false)
+	if err != nil {
+		slog.Warn("failed to backfill star history", "repository", repo.String(), "details", err.Error())
+		return
+	}
+
+	// Add the times of starring to the star history.
+	stats.updateStars(func(timeline *starTimeline) {
+		timeline.addStarred(users)
+		timeline.Backfilled = true
+	})
+
+	slog.Info("successfully backfilled star history", "repository", repo.String(), "stargazers", len(users))
+}
+
+// encodedStarHistory returns the star history chart of the given stats drawn
+// with the given options and encoded in the given format ("svg" or "png").
+// Like the final images, the encoded charts are kept in the bounded LRU cache
+// until the next update of the stats, and the concurrent requests for the same
+// variant are coalesced into one in-flight render.
+func (c *Config) encodedStarHistory(s *Stats, format string, o chartOptions) ([]byte, error) {
+	// Get the current repository and the time of the last update.
+	repo, updatedAt := s.repository(), s.lastUpdate()
+
+	// Create a key for the cache of the encoded images.
+	key := fmt.Sprintf("star-history.%s.%d.%+v", format, updatedAt.UnixNano(), o)
+
+	// Return the cached encoded chart, if it exists.
+	if encoded, ok := s.encoded.get(key); ok {
+		metricCacheRequests.inc("hit")
+		return encoded, nil
+	}
+	metricCacheRequests.inc("miss")
+
+	// Draw and encode the chart in the in-flight call (or join the existing one for the same variant).
+	call := s.flights.do(key, func() (any, error) {
+		// Select the points within the time range of the options (up to the last update).
+		to := updatedAt
+		if to.IsZero() {
+			to = time.Now()
+		}
+		from := time.Time{}
+		if o.Range > 0 {
+			from = to.Add(-o.Range)
+		}
+		layout := makeChartLayout(fmt.Sprintf("Star history of %s", repo.String()), s.starTimeline().points(from, to))
+
+		// Draw the chart in the given format.
+		var buf bytes.Buffer
+		if format == "svg" {
+			buf.Write(makeChartSVG(layout, o.theme()))
+		} else {
+			chart, err := makeChartImage(layout, o.theme())
+			if err != nil {
+				return nil, err
+			}
+			if err := c.encodeImage(&buf, chart, "png"); err != nil {
+				return nil, err
+			}
+		}
+
+		// Save the encoded chart to the cache.
+		s.encoded.add(key, buf.Bytes())
+
+		return buf.Bytes(), nil
+	})
+
+	// Wait for the result of the in-flight call.
+	encoded, err := call.wait(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return encoded.([]byte), nil
+}
+
+// writeStarTimeline writes the given star history to the given directory.
+func writeStarTimeline(dir string, timeline starTimeline) error {
+	data, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalIndent(timeline, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, starHistoryFile), data, 0o644)
+}
+
+// readStarTimeline reads the star history from the given directory. It returns
+// an empty star history, if the file does not exist.
+func readStarTimeline(dir string) (starTimeline, error) {
+	timeline := newStarTimeline()
+
+	// Read the file of the star history, if it exists.
+	data, err := os.ReadFile(filepath.Join(dir, starHistoryFile))
+	if os.IsNotExist(err) {
+		return timeline, nil
+	}
+	if err != nil {
+		return starTimeline{}, err
+	}
+
+	// Decode the star history.
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, &timeline); err != nil {
+		return starTimeline{}, fmt.Errorf("failed to decode %s (%s)", starHistoryFile, err.Error())
+	}
+	if timeline.Starred == nil {
+		timeline.Starred = make(map[string]time.Time)
+	}
+
+	return timeline, nil
+}
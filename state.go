@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// stateImagesFile is the name of the file with the list of the encoded final
+// images in the state directory of the repository.
+const stateImagesFile = "images.json"
+
+// stateImage represents the encoded final image in the state directory of the
+// repository. The render options are saved to check, if the image still
+// matches the definition of the image after the restart.
+type stateImage struct {
+	Name    string `json:"name"`
+	Format  string `json:"format"`
+	Options string `json:"options"`
+	Key     string `json:"key,omitempty"`
+	File    string `json:"file"`
+}
+
+// stateMu serializes the writes to the state directories, so the history is
+// never written to the state directory, which is being replaced.
+var stateMu sync.Mutex
+
+// statePath returns the path to the state directory of the given repository
+// (e.g., "<STATE_DIR>/koddr/wonderful-readme-stats").
+func (c *Config) statePath(repo *repository) string {
+	return filepath.Join(c.StateDir, filepath.FromSlash(registryKey(repo.Owner, repo.Name)))
+}
+
+// stateSave persists the last good state of the given stats to the state
+// directory of its repository, if the STATE_DIR is set: the snapshot with the
+// users and their avatar images, the final images encoded in all allowed
+// formats of each image, the history of the changes of the users, the star
+// history and the lost stargazers.
+//
+// Only the changes are encoded: the avatar images (by their URLs) and the
+// encoded final images (by their users and options), which are not changed
+// since the previous state, are linked (or copied) from it.
+//
+// The state is written to a temporary directory first. Then the previous state
+// is renamed aside, and the new one takes its place, so the state directory
+// never contains a partial state (and the state renamed aside is restored at
+// startup, if the process stops between the two renames).
+func (c *Config) stateSave(stats *Stats) error {
+	// Skip, if the state directory is not set.
+	if c.StateDir == "" {
+		return nil
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	// Get the current repository and the store of the stats.
+	repo, store := stats.repository(), stats.store()
+
+	// Create a temporary directory next to the state directory of the repository.
+	path := c.statePath(repo)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// Create a snapshot of the users, and save their avatar images to the temporary directory.
+	snap, err := makeSnapshot(repo, store, false)
+	if err != nil {
+		return err
+	}
+	snap.FetchedAt = stats.lastUpdate().UTC()
+	if err := stateSaveAvatars(path, tmp, snap, store); err != nil {
+		return err
+	}
+	if err := saveSnapshot(tmp, snap); err != nil {
+		return err
+	}
+
+	// Create the directory for the encoded final images.
+	if err := os.MkdirAll(filepath.Join(tmp, "images"), 0o755); err != nil {
+		return err
+	}
+
+	// Read the encoded final images of the previous state, if they exist.
+	prevImages := make(map[string]stateImage)
+	for _, image := range stateReadImages(path) {
+		prevImages[image.File] = image
+	}
+
+	// Save the final images in all allowed formats to the temporary directory (the unchanged ones are reused).
+	images := make([]stateImage, 0, len(repo.Images))
+	for _, def := range repo.Images {
+		for _, format := range def.Formats {
+			image := stateImage{
+				Name:    def.Name,
+				Format:  format,
+				Options: fmt.Sprintf("%+v", def.Options),
+				Key:     stateImageKey(def, stats.avatars(def.Name)),
+				File:    filepath.ToSlash(filepath.Join("images", def.Name+"."+format)),
+			}
+			images = append(images, image)
+
+			// Reuse the encoded image of the previous state, if it is not changed.
+			if prev, ok := prevImages[image.File]; ok && prev.Key == image.Key && prev.Options == image.Options &&
+				stateLink(filepath.Join(path, image.File), filepath.Join(tmp, image.File)) == nil {
+				continue
+			}
+
+			// Encode the changed image.
+			encoded, err := c.encodedImage(stats, def, format, def.Options)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(tmp, image.File), encoded, 0o644); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Save the list of the encoded final images.
+	data, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalIndent(images, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, stateImagesFile), data, 0o644); err != nil {
+		return err
+	}
+
+	// Save the history of the changes of the users, and the known notifiers.
+	if err := writeHistory(tmp, stats.history()); err != nil {
+		return err
+	}
+	if err := writeNotifiers(tmp, stats.knownNotifiers()); err != nil {
+		return err
+	}
+
+	// Save the star history.
+	if err := writeStarTimeline(tmp, stats.starTimeline()); err != nil {
+		return err
+	}
+
+	// Save the lost stargazers.
+	if err := writeLostStargazers(tmp, stats.lostStargazers()); err != nil {
+		return err
+	}
+
+	// Replace the previous state with the new one.
+	return stateSwap(path, tmp)
+}
+
+// stateSwap replaces the given state directory with the given temporary one:
+// the previous state is renamed aside (the stale one of the failed save is
+// removed first), and the new one takes its place (or the previous state is
+// put back, if it fails).
+func stateSwap(path, tmp string) error {
+	// Rename the previous state aside.
+	aside := stateAsidePath(path)
+	if err := os.RemoveAll(aside); err != nil {
+		return err
+	}
+	if err := os.Rename(path, aside); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Replace the previous state with the new one.
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Rename(aside, path)
+		return err
+	}
+
+	return os.RemoveAll(aside)
+}
+
+// stateAsidePath returns the path, where the previous state of the given state
+// directory is renamed aside, while the new state takes its place.
+func stateAsidePath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"-previous")
+}
+
+// stateSaveAvatars saves the avatar images of the users of the given store to
+// the "avatars" subdirectory of the given temporary directory, and sets their
+// files to the users of the given snapshot (made from the same store). The
+// files are named by the URLs of the avatars, so the unchanged avatars are
+// linked from the given previous state directory instead of being encoded.
+func stateSaveAvatars(prev, tmp string, snap snapshot, store ImageStore) error {
+	// Create the directory for the avatar images.
+	if err := os.MkdirAll(filepath.Join(tmp, "avatars"), 0o755); err != nil {
+		return err
+	}
+
+	for _, pair := range []struct {
+		users   []snapshotUser
+		avatars []UserAvatar
+	}{{snap.Stargazers, store.Stargazers}, {snap.Contributors, store.Contributors}} {
+		for i, avatar := range pair.avatars {
+			// Skip the users without the avatar images.
+			if avatar.Image == nil {
+				continue
+			}
+
+			// Set the file of the avatar image by the hash of its URL.
+			hash := sha256.Sum256([]byte(avatar.URL))
+			file := filepath.ToSlash(filepath.Join("avatars", hex.EncodeToString(hash[:8])+".png"))
+			pair.users[i].AvatarFile = file
+
+			// Skip the avatar image, if it is already saved (or linked from the previous state).
+			if _, err := os.Stat(filepath.Join(tmp, file)); err == nil {
+				continue
+			}
+			if stateLink(filepath.Join(prev, file), filepath.Join(tmp, file)) == nil {
+				continue
+			}
+
+			// Encode the new avatar image to the PNG format.
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, avatar.Image); err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(tmp, file), buf.Bytes(), 0o644); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// stateImageKey returns the key of the content of the final image of the given
+// definition: the hash of its render options and the avatars of its users, so
+// the key is changed only when the final image is changed.
+func stateImageKey(def *imageDefinition, avatars []UserAvatar) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%+v\n", def.Options)
+	for _, avatar := range prepareVisibleAvatars(avatars, def.Options) {
+		fmt.Fprintf(hash, "%s %s\n", avatar.Login, avatar.URL)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// stateLink links the given file of the previous state to the given path of
+// the new state, or copies it, if the file system does not support the hard
+// links.
+func stateLink(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, data, 0o644)
+}
+
+// stateReadImages reads the list of the encoded final images from the given
+// state directory. It returns an empty list, if the list does not exist or
+// cannot be decoded.
+func stateReadImages(path string) []stateImage {
+	images := make([]stateImage, 0)
+	if data, err := os.ReadFile(filepath.Join(path, stateImagesFile)); err == nil {
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, &images); err != nil {
+			return make([]stateImage, 0)
+		}
+	}
+
+	return images
+}
+
+// stateLoad restores the last good state of the given repository from its
+// state directory, if the STATE_DIR is set and the state exists. It returns
+// nil stats (and nil error), if there is no state to restore.
+//
+// The final images are prepared from the avatar images of the snapshot (with
+// the current definitions of the images), and the encoded final images, which
+// still match the definitions, are put to the cache of the stats.
+func (c *Config) stateLoad(repo *repository) (*Stats, error) {
+	// Skip, if the state directory is not set.
+	path := c.statePath(repo)
+	if c.StateDir == "" {
+		return nil, nil
+	}
+
+	// Use the previous state renamed aside, if the state does not exist (the process stopped while saving it), or
+	// skip, if there is no state at all.
+	if _, err := os.Stat(filepath.Join(path, snapshotFile)); err != nil {
+		path = stateAsidePath(path)
+		if _, err := os.Stat(filepath.Join(path, snapshotFile)); err != nil {
+			return nil, nil
+		}
+	}
+
+	// Load the snapshot and decode the avatar images.
+	snap, err := loadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	store, err := snap.store()
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare the final images from the avatar images of the snapshot.
+	stats := newStats(repo, c.OutputImage.CacheSize)
+	if err := c.renderStats(stats, store); err != nil {
+		return nil, err
+	}
+	stats.setUpdatedAt(snap.FetchedAt)
+
+	// Restore the history of the changes of the users.
+	history, err := readHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	stats.setHistory(history)
+
+	// Restore the known notifiers.
+	notifiers, err := readNotifiers(path, history)
+	if err != nil {
+		return nil, err
+	}
+	stats.setNotifiers(notifiers)
+
+	// Restore the star history.
+	timeline, err := readStarTimeline(path)
+	if err != nil {
+		return nil, err
+	}
+	stats.setStarTimeline(timeline)
+
+	// Restore the lost stargazers.
+	lost, err := readLostStargazers(path)
+	if err != nil {
+		return nil, err
+	}
+	stats.setLostStargazers(lost)
+
+	// Put the encoded final images, which still match the definitions of the images, to the cache.
+	for _, image := range stateReadImages(path) {
+		def := repo.image(image.Name)
+		if def == nil || !def.allowsFormat(image.Format) || image.Options != fmt.Sprintf("%+v", def.Options) ||
+			strings.Contains(image.File, "..") {
+			continue
+		}
+
+		encoded, err := os.ReadFile(filepath.Join(path, filepath.FromSlash(image.File)))
+		if err != nil {
+			continue
+		}
+		stats.encoded.add(encodedKey(def.Name, image.Format, stats.lastUpdate(), def.Options), encoded)
+	}
+
+	slog.Info(
+		"successfully restored state",
+		"repository", repo.String(), "fetched_at", snap.FetchedAt,
+		"stargazers", len(store.Stargazers), "contributors", len(store.Contributors),
+	)
+
+	return stats, nil
+}
+
+// stateSaveHistory saves the history and the known notifiers of the given
+// stats to the state directory of its repository, if the STATE_DIR is set and
+// the state exists (e.g., after the notifications are delivered).
+//
+// The other files of the state are linked (or copied) to a temporary directory
+// with the new history and notifiers, which replaces the state directory the
+// same way as in the stateSave function.
+func (c *Config) stateSaveHistory(stats *Stats) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	// Skip, if the state directory is not set or the state does not exist.
+	path := c.statePath(stats.repository())
+	if c.StateDir == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	// Link the files of the state to a temporary directory next to the state directory (except the history and
+	// the known notifiers).
+	tmp, err := os.MkdirTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	err = filepath.WalkDir(path, func(src string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, src)
+		if err != nil || rel == "." || rel == historyFile || rel == notifiersFile {
+			return err
+		}
+		if entry.IsDir() {
+			return os.MkdirAll(filepath.Join(tmp, rel), 0o755)
+		}
+		return stateLink(src, filepath.Join(tmp, rel))
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write the history and the known notifiers, then replace the state with the temporary directory, so both of
+	// them are replaced together.
+	if err := writeHistory(tmp, stats.history()); err != nil {
+		return err
+	}
+	if err := writeNotifiers(tmp, stats.knownNotifiers()); err != nil {
+		return err
+	}
+
+	return stateSwap(path, tmp)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"time"
+)
+
+// statusImage is a struct that represents the named image of the repository
+// in the status response.
+type statusImage struct {
+	Name    string   `json:"name"`
+	Source  string   `json:"source"`
+	Users   int      `json:"users"`
+	Formats []string `json:"formats"`
+}
+
+// statusRepository is a struct that represents the repository in the status
+// response: the time of the last successful refresh, the last error, the
+// number of users and the time of the next scheduled refresh.
+type statusRepository struct {
+	Repository    string        `json:"repository"`
+	UpdatedAt     *time.Time    `json:"updated_at"`
+	NextRefreshAt *time.Time    `json:"next_refresh_at"`
+	LastError     string        `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time    `json:"last_error_at,omitempty"`
+	Stargazers    int           `json:"stargazers"`
+	Contributors  int           `json:"contributors"`
+	Images        []statusImage `json:"images"`
+}
+
+// statusRateLimit is a struct that represents the last known rate limit of
+// the GitHub API in the status response.
+type statusRateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// statusResponse is a struct that represents the status response of the
+// application.
+type statusResponse struct {
+	Ready           bool               `json:"ready"`
+	Version         string             `json:"version"`
+	GithubRateLimit *statusRateLimit   `json:"github_rate_limit"`
+	Repositories    []statusRepository `json:"repositories"`
+}
+
+// makeStatusResponse makes a status response with all repositories of the
+// given registry and the last known rate limit of the GitHub API.
+func (c *Config) makeStatusResponse(reg *Registry) statusResponse {
+	// Create a new status response.
+	response := statusResponse{
+		Ready:        c.isReady(reg),
+		Version:      version,
+		Repositories: make([]statusRepository, 0),
+	}
+
+	// Set the rate limit of the GitHub API, if it is known.
+	if limit, remaining, resetAt, ok := githubRateLimit.get(); ok {
+		response.GithubRateLimit = &statusRateLimit{Limit: limit, Remaining: remaining, ResetAt: resetAt}
+	}
+
+	for _, stats := range reg.list() {
+		// Get the current state of the repository.
+		repo, store := stats.repository(), stats.store()
+		lastError, lastErrorAt, nextRefresh := stats.health()
+
+		// Create a new repository for the response.
+		item := statusRepository{
+			Repository:    repo.String(),
+			UpdatedAt:     makeStatusTime(stats.lastUpdate()),
+			NextRefreshAt: makeStatusTime(nextRefresh),
+			LastError:     lastError,
+			LastErrorAt:   makeStatusTime(lastErrorAt),
+			Stargazers:    len(store.Stargazers),
+			Contributors:  len(store.Contributors),
+			Images:        make([]statusImage, 0, len(repo.Images)),
+		}
+
+		// Add the images of the repository with their number of users.
+		for _, def := range repo.Images {
+			item.Images = append(item.Images, statusImage{
+				Name:    def.Name,
+				Source:  def.Source,
+				Users:   len(stats.avatars(def.Name)),
+				Formats: def.Formats,
+			})
+		}
+
+		response.Repositories = append(response.Repositories, item)
+	}
+
+	return response
+}
+
+// makeStatusTime returns a pointer to the given time, or nil if it is zero (so
+// it is encoded as null or omitted).
+func makeStatusTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// isReady checks, if the application is ready to serve the final images: the
+// first snapshot (fetched or restored) of the default repository exists.
+func (c *Config) isReady(reg *Registry) bool {
+	stats, ok := reg.lookup(c.Repository.Owner, c.Repository.Name)
+
+	return ok && !stats.lastUpdate().IsZero()
+}
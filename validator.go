@@ -1,38 +1,168 @@
 package main
 
 import (
+	"fmt"
+	"image/color"
+	"image/png"
+	"math"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config represents the configuration of the application.
 type Config struct {
-	GithubToken string
-	Repository  *repository
-	Server      *server
-	Avatar      *avatar
-	OutputImage *outputImage
+	ConfigFile            string
+	ConfigWatchInterval   int
+	GithubToken           string
+	GithubMaxPages        int
+	GithubWebhookSecret   string
+	GithubWebhookDebounce int
+	StateDir              string
+	Repository            *repository
+	Repositories          *repositories
+	Server                *server
+	Admin                 *admin
+	Notify                *notify
+	StarHistory           *starHistory
+	Avatar                *avatar
+	OutputImage           *outputImage
 }
 
-// repository represents the GitHub repository of the application.
+// repository represents the GitHub repository of the application with the
+// refresh interval and the definitions of its images.
 type repository struct {
-	Owner, Name string
+	Owner, Name     string
+	RefreshInterval int
+	Images          []*imageDefinition
+}
+
+// String returns the full name of the repository (e.g., "koddr/wonderful-readme-stats").
+func (r *repository) String() string {
+	return r.Owner + "/" + r.Name
+}
+
+// image returns the definition of the image with the given name, or nil if
+// the repository has no such image.
+func (r *repository) image(name string) *imageDefinition {
+	for _, def := range r.Images {
+		if def.Name == name {
+			return def
+		}
+	}
+
+	return nil
+}
+
+// usesSource checks, if any image of the repository uses the given source
+// ("stargazers" or "contributors").
+func (r *repository) usesSource(source string) bool {
+	for _, def := range r.Images {
+		if def.Source == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// usesOrder checks, if any image of the repository, which uses the given
+// source, orders the users by the given order (e.g., "newest").
+func (r *repository) usesOrder(source, order string) bool {
+	for _, def := range r.Images {
+		if def.Source == source && def.Order == order {
+			return true
+		}
+	}
+
+	return false
+}
+
+// imageDefinition represents the definition of the named image of the
+// repository: the source of the users, the filters and ordering of the users,
+// the render options (layout and shape) and the allowed output formats.
+type imageDefinition struct {
+	Name, Source, Order string
+	Filters             imageFilters
+	Options             renderOptions
+	Formats             []string
+}
+
+// allowsFormat checks, if the given output format is allowed for the image.
+// The snippets, JSON API and Atom feed are allowed for any image. The empty
+// format (the name of the image without the extension) is allowed too, its
+// format is negotiated among the allowed ones by the Accept header.
+func (d *imageDefinition) allowsFormat(format string) bool {
+	if format == "" || format == "md" || format == "html" || format == "json" || format == "atom" {
+		return true
+	}
+
+	return slices.Contains(d.Formats, format)
+}
+
+// imageFilters represents the filters of the users for the image.
+type imageFilters struct {
+	Exclude          []string
+	ExcludeBots      bool
+	MinContributions int
+}
+
+// repositories represents the configuration of the repositories, which are
+// served by the application: the repositories declared in the configuration
+// file, and the allowlist of the repositories served on demand.
+type repositories struct {
+	Declared                  []*repository
+	Allowlist                 []string
+	IdleTimeout, FetchTimeout int
 }
 
 // server represents the server configuration of the application.
 type server struct {
-	Port, ReadTimeout, WriteTimeout int
+	Port, ReadTimeout, WriteTimeout, ShutdownTimeout int
+}
+
+// admin represents the admin API configuration of the application.
+type admin struct {
+	Token           string
+	RefreshCooldown int
+}
+
+// notify represents the notifications configuration of the application: the
+// URLs of the sinks of the notifications (empty to disable the sink).
+type notify struct {
+	WebhookURL, SlackURL, DiscordURL string
+}
+
+// starHistory represents the star history configuration of the application:
+// the number of the pages to backfill the star history from the GitHub API,
+// and the default options of the star history chart (the zero colors for the
+// ones of the theme).
+type starHistory struct {
+	Theme                      string
+	Range                      time.Duration
+	LineColor, BackgroundColor color.NRGBA
+	BackfillPages              int
 }
 
-// avatar represents the avatar configuration of the application.
+// avatar represents the avatar configuration of the application, with the
+// labels with the logins of the users.
 type avatar struct {
 	Shape                                  string
 	Size, HorizontalMargin, VerticalMargin int
 	RoundedRadius                          float64
+	Label, LabelFont                       string
+	LabelSize, LabelWidth                  int
+	LabelColor                             color.NRGBA
 }
 
 // outputImage represents the output image configuration of the application.
 type outputImage struct {
-	MaxPerRow, MaxRows, UpdateInterval int
+	MaxPerRow, MaxRows, UpdateInterval, JPEGQuality int
+	PNGColors, PNGMaxSize, CacheSize                int
+	PNGCompression                                  png.CompressionLevel
+	BackgroundColor                                 color.NRGBA
 }
 
 // validateEnvVariables initializes and validates the configuration from environment variables.
@@ -40,84 +170,337 @@ type outputImage struct {
 // It creates a new instance of the Config struct and populates it with values from environment variables.
 // The function parses various environment variables and assigns them to the corresponding fields in the Config struct.
 // It returns the populated Config struct and a nil error if the parsing is successful.
-// If any parsing error occurs, it returns a nil Config struct and the corresponding error.
+//
+// Each value is validated against its type, range or allowed values, and the cross-field rules (e.g., the radius of
+// the corners is not bigger than the half of the avatar size). All problems are collected and returned at once in
+// one error with the names of the environment variables and the allowed values.
+//
+// If the CONFIG_FILE environment variable is set, the configuration file is loaded first. Its settings are used
+// as the defaults for the environment variables, so the environment variables still override them.
 func validateEnvVariables() (*Config, error) {
+	// Load the configuration file, if it is set.
+	configFile := helpGetEnv("CONFIG_FILE", "")
+	fileRepositories, err := loadConfigFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a new validator to collect the problems of the configuration.
+	v := &configValidator{}
+
 	// Create a new instance of the Config struct.
 	c := &Config{
-		GithubToken: helpGetEnv("GITHUB_TOKEN", ""),
+		ConfigFile:          configFile,
+		GithubToken:         helpGetEnv("GITHUB_TOKEN", ""),
+		GithubWebhookSecret: helpGetEnv("GITHUB_WEBHOOK_SECRET", ""),
+		StateDir:            helpGetEnv("STATE_DIR", ""),
 		Repository: &repository{
-			Owner: helpGetEnv("REPOSITORY_OWNER", "koddr"),
-			Name:  helpGetEnv("REPOSITORY_NAME", "wonderful-readme-stats"),
+			Owner: v.parseString("REPOSITORY_OWNER", "koddr"),
+			Name:  v.parseString("REPOSITORY_NAME", "wonderful-readme-stats"),
+		},
+		Repositories: &repositories{},
+		Server:       &server{},
+		Admin:        &admin{Token: helpGetEnv("ADMIN_TOKEN", "")},
+		Notify: &notify{
+			WebhookURL: v.parseURL("NOTIFY_WEBHOOK_URL"),
+			SlackURL:   v.parseURL("NOTIFY_SLACK_WEBHOOK_URL"),
+			DiscordURL: v.parseURL("NOTIFY_DISCORD_WEBHOOK_URL"),
+		},
+		StarHistory: &starHistory{
+			Theme: v.parseEnum("STAR_HISTORY_THEME", "light", "light", "dark"),
+			Range: v.parseRange("STAR_HISTORY_RANGE", "all"),
 		},
-		Server: &server{},
 		Avatar: &avatar{
-			Shape: helpGetEnv("AVATAR_SHAPE", "rounded"),
+			Shape: v.parseEnum("AVATAR_SHAPE", "rounded", "rounded", "circular", "square"),
+			Label: v.parseEnum("AVATAR_LABEL", "none", "none", "below", "beside"),
 		},
 		OutputImage: &outputImage{},
 	}
 
-	var err error
+	// Parse the CONFIG_WATCH_INTERVAL environment variable and assign it to c.ConfigWatchInterval.
+	c.ConfigWatchInterval = v.parseInt("CONFIG_WATCH_INTERVAL", "5", 0, 3600)
+
+	// Parse the GITHUB_MAX_PAGES environment variable and assign it to c.GithubMaxPages.
+	c.GithubMaxPages = v.parseInt("GITHUB_MAX_PAGES", "1", 1, 400)
+
+	// Parse the GITHUB_WEBHOOK_DEBOUNCE environment variable and assign it to c.GithubWebhookDebounce.
+	c.GithubWebhookDebounce = v.parseInt("GITHUB_WEBHOOK_DEBOUNCE", "10", 0, 3600)
+
+	// Parse the REPOSITORY_ALLOWLIST environment variable and assign it to c.Repositories.Allowlist.
+	c.Repositories.Allowlist = helpSplitList(helpGetEnv("REPOSITORY_ALLOWLIST", c.Repository.String()))
 
 	// Parse the SERVER_PORT environment variable and assign it to c.Server.Port.
-	c.Server.Port, err = strconv.Atoi(helpGetEnv("SERVER_PORT", "9876"))
-	if err != nil {
-		return nil, err
-	}
+	c.Server.Port = v.parseInt("SERVER_PORT", "9876", 1, 65535)
 
 	// Parse the SERVER_READ_TIMEOUT environment variable and assign it to c.Server.ReadTimeout.
-	c.Server.ReadTimeout, err = strconv.Atoi(helpGetEnv("SERVER_READ_TIMEOUT", "5"))
-	if err != nil {
-		return nil, err
-	}
+	c.Server.ReadTimeout = v.parseInt("SERVER_READ_TIMEOUT", "5", 1, 3600)
 
 	// Parse the SERVER_WRITE_TIMEOUT environment variable and assign it to c.Server.WriteTimeout.
-	c.Server.WriteTimeout, err = strconv.Atoi(helpGetEnv("SERVER_WRITE_TIMEOUT", "10"))
-	if err != nil {
-		return nil, err
+	c.Server.WriteTimeout = v.parseInt("SERVER_WRITE_TIMEOUT", "10", 1, 3600)
+
+	// Parse the SERVER_SHUTDOWN_TIMEOUT environment variable and assign it to c.Server.ShutdownTimeout.
+	c.Server.ShutdownTimeout = v.parseInt("SERVER_SHUTDOWN_TIMEOUT", "15", 1, 3600)
+
+	// Parse the ADMIN_REFRESH_COOLDOWN environment variable and assign it to c.Admin.RefreshCooldown.
+	c.Admin.RefreshCooldown = v.parseInt("ADMIN_REFRESH_COOLDOWN", "60", 0, 86400)
+
+	// Parse the STAR_HISTORY_BACKFILL_PAGES environment variable and assign it to c.StarHistory.BackfillPages.
+	c.StarHistory.BackfillPages = v.parseInt("STAR_HISTORY_BACKFILL_PAGES", "10", 0, 400)
+
+	// Parse the STAR_HISTORY_LINE_COLOR environment variable and assign it to c.StarHistory.LineColor, if it is set
+	// (the color of the theme is used otherwise).
+	if helpGetEnv("STAR_HISTORY_LINE_COLOR", "") != "" {
+		c.StarHistory.LineColor = v.parseColor("STAR_HISTORY_LINE_COLOR", "#bf8700")
 	}
 
-	// Parse the AVATAR_SIZE environment variable and assign it to c.Avatar.Size.
-	c.Avatar.Size, err = strconv.Atoi(helpGetEnv("AVATAR_SIZE", "64"))
-	if err != nil {
-		return nil, err
+	// Parse the STAR_HISTORY_BACKGROUND_COLOR environment variable and assign it to c.StarHistory.BackgroundColor,
+	// if it is set (the color of the theme is used otherwise).
+	if helpGetEnv("STAR_HISTORY_BACKGROUND_COLOR", "") != "" {
+		c.StarHistory.BackgroundColor = v.parseColor("STAR_HISTORY_BACKGROUND_COLOR", "#ffffff")
 	}
 
+	// Parse the AVATAR_SIZE environment variable and assign it to c.Avatar.Size.
+	c.Avatar.Size = v.parseInt("AVATAR_SIZE", "64", 16, 256)
+
 	// Parse the AVATAR_HORIZONTAL_MARGIN environment variable and assign it to c.Avatar.HorizontalMargin.
-	c.Avatar.HorizontalMargin, err = strconv.Atoi(helpGetEnv("AVATAR_HORIZONTAL_MARGIN", "12"))
-	if err != nil {
-		return nil, err
-	}
+	c.Avatar.HorizontalMargin = v.parseInt("AVATAR_HORIZONTAL_MARGIN", "12", 0, 64)
 
 	// Parse the AVATAR_VERTICAL_MARGIN environment variable and assign it to c.Avatar.VerticalMargin.
-	c.Avatar.VerticalMargin, err = strconv.Atoi(helpGetEnv("AVATAR_VERTICAL_MARGIN", "12"))
-	if err != nil {
-		return nil, err
-	}
+	c.Avatar.VerticalMargin = v.parseInt("AVATAR_VERTICAL_MARGIN", "12", 0, 64)
 
 	// Parse the AVATAR_ROUNDED_RADIUS environment variable and assign it to c.Avatar.RoundedRadius.
-	c.Avatar.RoundedRadius, err = strconv.ParseFloat(helpGetEnv("AVATAR_ROUNDED_RADIUS", "16.0"), 64)
-	if err != nil {
-		return nil, err
+	// The radius of the corners must not be bigger than the half of the avatar size (the default one is limited by
+	// it, so the small avatars work without the radius).
+	c.Avatar.RoundedRadius = v.parseFloat(
+		"AVATAR_ROUNDED_RADIUS", strconv.FormatFloat(min(16, float64(c.Avatar.Size)/2), 'f', 1, 64),
+		0, float64(c.Avatar.Size)/2,
+	)
+
+	// Parse the AVATAR_LABEL_FONT environment variable and assign it to c.Avatar.LabelFont.
+	// The font must be loaded from the given path (the bundled Go Regular font is used, if it is not set).
+	c.Avatar.LabelFont = helpGetEnv("AVATAR_LABEL_FONT", "")
+	if _, err := helpLoadFont(c.Avatar.LabelFont); err != nil {
+		v.check(false, "AVATAR_LABEL_FONT", c.Avatar.LabelFont, "a path to the TrueType font file")
+		c.Avatar.LabelFont = ""
 	}
 
+	// Parse the AVATAR_LABEL_SIZE environment variable and assign it to c.Avatar.LabelSize.
+	c.Avatar.LabelSize = v.parseInt("AVATAR_LABEL_SIZE", "12", 6, 48)
+
+	// Parse the AVATAR_LABEL_WIDTH environment variable and assign it to c.Avatar.LabelWidth.
+	c.Avatar.LabelWidth = v.parseInt("AVATAR_LABEL_WIDTH", "96", 16, 256)
+
+	// Parse the AVATAR_LABEL_COLOR environment variable and assign it to c.Avatar.LabelColor.
+	c.Avatar.LabelColor = v.parseColor("AVATAR_LABEL_COLOR", "#24292f")
+
 	// Parse the OUTPUT_IMAGE_MAX_PER_ROW environment variable and assign it to c.OutputImage.MaxPerRow.
-	c.OutputImage.MaxPerRow, err = strconv.Atoi(helpGetEnv("OUTPUT_IMAGE_MAX_PER_ROW", "16"))
-	if err != nil {
-		return nil, err
-	}
+	c.OutputImage.MaxPerRow = v.parseInt("OUTPUT_IMAGE_MAX_PER_ROW", "16", 1, 32)
 
 	// Parse the OUTPUT_IMAGE_MAX_ROWS environment variable and assign it to c.OutputImage.MaxRows.
-	c.OutputImage.MaxRows, err = strconv.Atoi(helpGetEnv("OUTPUT_IMAGE_MAX_ROWS", "2"))
-	if err != nil {
-		return nil, err
-	}
+	c.OutputImage.MaxRows = v.parseInt("OUTPUT_IMAGE_MAX_ROWS", "2", 1, 16)
 
 	// Parse the OUTPUT_IMAGE_UPDATE_INTERVAL environment variable and assign it to c.OutputImage.UpdateInterval.
-	c.OutputImage.UpdateInterval, err = strconv.Atoi(helpGetEnv("OUTPUT_IMAGE_UPDATE_INTERVAL", "3600"))
-	if err != nil {
+	// The update interval must not be lower than the minimum for the rate limits of the GitHub API.
+	c.OutputImage.UpdateInterval = v.parseInt("OUTPUT_IMAGE_UPDATE_INTERVAL", "3600", c.minUpdateInterval(), math.MaxInt)
+
+	// Parse the OUTPUT_IMAGE_JPEG_QUALITY environment variable and assign it to c.OutputImage.JPEGQuality.
+	c.OutputImage.JPEGQuality = v.parseInt("OUTPUT_IMAGE_JPEG_QUALITY", "90", 1, 100)
+
+	// Parse the OUTPUT_IMAGE_BACKGROUND_COLOR environment variable and assign it to c.OutputImage.BackgroundColor.
+	c.OutputImage.BackgroundColor = v.parseColor("OUTPUT_IMAGE_BACKGROUND_COLOR", "#ffffff")
+
+	// Parse the OUTPUT_IMAGE_PNG_COMPRESSION environment variable and assign it to c.OutputImage.PNGCompression.
+	c.OutputImage.PNGCompression, _ = helpParsePNGCompression(
+		v.parseEnum("OUTPUT_IMAGE_PNG_COMPRESSION", "default", "default", "none", "speed", "best"),
+	)
+
+	// Parse the OUTPUT_IMAGE_PNG_COLORS environment variable and assign it to c.OutputImage.PNGColors.
+	// The paletted output needs at least 2 colors (0 means the true color).
+	c.OutputImage.PNGColors = v.parseInt("OUTPUT_IMAGE_PNG_COLORS", "0", 0, 256)
+	v.check(c.OutputImage.PNGColors != 1, "OUTPUT_IMAGE_PNG_COLORS", "1", "0 or an integer from 2 to 256")
+
+	// Parse the OUTPUT_IMAGE_PNG_MAX_SIZE environment variable and assign it to c.OutputImage.PNGMaxSize.
+	c.OutputImage.PNGMaxSize = v.parseInt("OUTPUT_IMAGE_PNG_MAX_SIZE", "0", 0, math.MaxInt)
+
+	// Parse the REPOSITORY_IDLE_TIMEOUT environment variable and assign it to c.Repositories.IdleTimeout.
+	c.Repositories.IdleTimeout = v.parseInt("REPOSITORY_IDLE_TIMEOUT", "86400", 60, math.MaxInt)
+
+	// Parse the REPOSITORY_FETCH_TIMEOUT environment variable and assign it to c.Repositories.FetchTimeout.
+	c.Repositories.FetchTimeout = v.parseInt("REPOSITORY_FETCH_TIMEOUT", "5", 0, 300)
+
+	// Parse the OUTPUT_IMAGE_CACHE_SIZE environment variable and assign it to c.OutputImage.CacheSize.
+	c.OutputImage.CacheSize = v.parseInt("OUTPUT_IMAGE_CACHE_SIZE", "64", 1, 4096)
+
+	// Set the refresh interval and the default images of the default repository.
+	c.Repository.RefreshInterval, c.Repository.Images = c.OutputImage.UpdateInterval, c.defaultImages()
+
+	// Create and validate the repositories declared in the configuration file.
+	c.Repositories.Declared = c.loadRepositories(fileRepositories, v)
+
+	// Return all problems of the configuration at once, if they exist.
+	if err := v.err(); err != nil {
 		return nil, err
 	}
 
 	// Return the populated Config struct and nil error, indicating success.
 	return c, nil
 }
+
+// minUpdateInterval returns the minimum update interval (in seconds) of the
+// output images. Without the GitHub token, the application works with the
+// public rate limits of the GitHub API, so the minimum is much higher.
+func (c *Config) minUpdateInterval() int {
+	if c.GithubToken == "" {
+		return 3600
+	}
+
+	return 60
+}
+
+// defaultImages returns the definitions of the default images of a repository:
+// "stargazers" and "contributors" with all users, the default render options
+// and all output formats.
+func (c *Config) defaultImages() []*imageDefinition {
+	// Create a slice to store the definitions of the default images.
+	images := make([]*imageDefinition, 0, 2)
+
+	for _, source := range []string{"stargazers", "contributors"} {
+		images = append(images, &imageDefinition{
+			Name:    source,
+			Source:  source,
+			Order:   "default",
+			Options: c.defaultRenderOptions(),
+			Formats: []string{"png", "webp", "jpeg"},
+		})
+	}
+
+	return images
+}
+
+// configValidator collects the problems of the configuration, so all of them
+// are reported at once instead of failing on the first one.
+type configValidator struct {
+	problems []string
+}
+
+// check adds the problem with the given setting (the name of the environment
+// variable or the key of the configuration file), its value and the allowed
+// values, if the given condition is false.
+func (v *configValidator) check(ok bool, name, value, allowed string) {
+	if !ok {
+		v.problems = append(v.problems, fmt.Sprintf("%s='%s' (must be %s)", name, value, allowed))
+	}
+}
+
+// parseString parses the given environment variable as a non-empty string.
+func (v *configValidator) parseString(name, fallback string) string {
+	value := helpGetEnv(name, fallback)
+	v.check(value != "", name, value, "a non-empty string")
+
+	return value
+}
+
+// parseURL parses the given environment variable as an optional HTTP or HTTPS
+// URL (empty, if it is not set).
+func (v *configValidator) parseURL(name string) string {
+	value := helpGetEnv(name, "")
+	if value == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		v.check(false, name, value, "an HTTP or HTTPS URL")
+		return ""
+	}
+
+	return value
+}
+
+// parseEnum parses the given environment variable as one of the allowed
+// values. If the value is not valid, it returns the fallback.
+func (v *configValidator) parseEnum(name, fallback string, allowed ...string) string {
+	value := helpGetEnv(name, fallback)
+	if !slices.Contains(allowed, value) {
+		v.check(false, name, value, "one of: "+strings.Join(allowed, ", "))
+		return fallback
+	}
+
+	return value
+}
+
+// parseInt parses the given environment variable as an integer from min to
+// max. If the value is not valid, it returns the parsed fallback, so the
+// cross-field rules do not report the same problem again.
+func (v *configValidator) parseInt(name, fallback string, min, max int) int {
+	value := helpGetEnv(name, fallback)
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < min || parsed > max {
+		v.check(false, name, value, describeRange(min, max))
+		parsed, _ = strconv.Atoi(fallback)
+	}
+
+	return parsed
+}
+
+// parseFloat parses the given environment variable as a number from min to
+// max. If the value is not valid, it returns the parsed fallback (limited by
+// the max).
+func (v *configValidator) parseFloat(name, fallback string, min, max float64) float64 {
+	value := helpGetEnv(name, fallback)
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < min || parsed > max {
+		v.check(false, name, value, fmt.Sprintf("a number from %g to %g", min, max))
+		parsed, _ = strconv.ParseFloat(fallback, 64)
+		parsed = math.Min(parsed, max)
+	}
+
+	return parsed
+}
+
+// parseColor parses the given environment variable as a hex color (e.g.,
+// "#ffffff"). If the value is not valid, it returns the parsed fallback.
+func (v *configValidator) parseColor(name, fallback string) color.NRGBA {
+	value := helpGetEnv(name, fallback)
+	parsed, err := helpParseHexColor(value)
+	if err != nil {
+		v.check(false, name, value, "a hex color in the #rrggbb format")
+		parsed, _ = helpParseHexColor(fallback)
+	}
+
+	return parsed
+}
+
+// parseRange parses the given environment variable as the time range of the
+// star history (e.g., "all" or "6m"). If the value is not valid, it returns
+// the parsed fallback.
+func (v *configValidator) parseRange(name, fallback string) time.Duration {
+	value := helpGetEnv(name, fallback)
+	parsed, err := helpParseRange(value)
+	if err != nil {
+		v.check(false, name, value, "'all' or a number from 1 to 100 with d, w, m or y (e.g., '6m')")
+		parsed, _ = helpParseRange(fallback)
+	}
+
+	return parsed
+}
+
+// err returns an error with all collected problems, or nil if there are no
+// problems.
+func (v *configValidator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("invalid configuration, %d problem(s): %s", len(v.problems), strings.Join(v.problems, "; "))
+}
+
+// describeRange returns the description of the allowed range of integers
+// (e.g., "an integer from 1 to 100" or "an integer of at least 60").
+func describeRange(min, max int) string {
+	if max == math.MaxInt {
+		return fmt.Sprintf("an integer of at least %d", min)
+	}
+
+	return fmt.Sprintf("an integer from %d to %d", min, max)
+}
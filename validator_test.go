@@ -0,0 +1,174 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidatorParseInt(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        int
+		wantProblem string
+	}{
+		{"valid", "42", 42, ""},
+		{"min", "1", 1, ""},
+		{"below min", "0", 10, "TEST_INT='0' (must be an integer from 1 to 100)"},
+		{"above max", "101", 10, "TEST_INT='101' (must be an integer from 1 to 100)"},
+		{"not a number", "ten", 10, "TEST_INT='ten' (must be an integer from 1 to 100)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_INT", tt.value)
+
+			v := &configValidator{}
+			if got := v.parseInt("TEST_INT", "10", 1, 100); got != tt.want {
+				t.Errorf("parseInt(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+			checkProblems(t, v, tt.wantProblem)
+		})
+	}
+}
+
+func TestConfigValidatorParseFloat(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        float64
+		wantProblem string
+	}{
+		{"valid", "1.5", 1.5, ""},
+		{"below min", "0", 2, "TEST_FLOAT='0' (must be a number from 1 to 4)"},
+		{"not a number", "x", 2, "TEST_FLOAT='x' (must be a number from 1 to 4)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_FLOAT", tt.value)
+
+			v := &configValidator{}
+			if got := v.parseFloat("TEST_FLOAT", "2", 1, 4); got != tt.want {
+				t.Errorf("parseFloat(%q) = %g, want %g", tt.value, got, tt.want)
+			}
+			checkProblems(t, v, tt.wantProblem)
+		})
+	}
+}
+
+func TestConfigValidatorParseEnum(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        string
+		wantProblem string
+	}{
+		{"valid", "circle", "circle", ""},
+		{"unknown", "triangle", "square", "TEST_ENUM='triangle' (must be one of: square, circle)"},
+		{"empty", "", "square", "TEST_ENUM='' (must be one of: square, circle)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_ENUM", tt.value)
+
+			v := &configValidator{}
+			if got := v.parseEnum("TEST_ENUM", "square", "square", "circle"); got != tt.want {
+				t.Errorf("parseEnum(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+			checkProblems(t, v, tt.wantProblem)
+		})
+	}
+}
+
+func TestConfigValidatorErr(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []bool
+		want   string
+	}{
+		{"no problems", []bool{true, true}, ""},
+		{"one problem", []bool{true, false}, "invalid configuration, 1 problem(s): B='1' (must be valid)"},
+		{
+			"all problems are collected", []bool{false, false},
+			"invalid configuration, 2 problem(s): A='0' (must be valid); B='1' (must be valid)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &configValidator{}
+			for i, ok := range tt.checks {
+				v.check(ok, string(rune('A'+i)), string(rune('0'+i)), "valid")
+			}
+
+			err := v.err()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("err() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("err() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeRange(t *testing.T) {
+	if got, want := describeRange(1, 100), "an integer from 1 to 100"; got != want {
+		t.Errorf("describeRange(1, 100) = %q, want %q", got, want)
+	}
+	if got, want := describeRange(60, math.MaxInt), "an integer of at least 60"; got != want {
+		t.Errorf("describeRange(60, MaxInt) = %q, want %q", got, want)
+	}
+}
+
+// checkProblems checks, if the given validator collected the given problem
+// only (or no problems, if it is empty).
+func checkProblems(t *testing.T, v *configValidator, want string) {
+	t.Helper()
+
+	if want == "" {
+		if len(v.problems) != 0 {
+			t.Errorf("problems = %s, want none", strings.Join(v.problems, "; "))
+		}
+		return
+	}
+	if len(v.problems) != 1 || v.problems[0] != want {
+		t.Errorf("problems = %q, want [%q]", v.problems, want)
+	}
+}
+
+func TestValidateEnvVariablesUpdateInterval(t *testing.T) {
+	tests := []struct {
+		name, token, interval string
+		wantProblem           string
+	}{
+		{"default", "", "3600", ""},
+		{"too low without token", "", "60", "OUTPUT_IMAGE_UPDATE_INTERVAL='60' (must be an integer of at least 3600)"},
+		{"too low with token", "token", "5", "OUTPUT_IMAGE_UPDATE_INTERVAL='5' (must be an integer of at least 60)"},
+		{"low with token", "token", "60", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_TOKEN", tt.token)
+			t.Setenv("OUTPUT_IMAGE_UPDATE_INTERVAL", tt.interval)
+			t.Setenv("AVATAR_SIZE", "8")
+
+			// The problem is reported with the other ones (the too small avatar size).
+			_, err := validateEnvVariables()
+			if err == nil {
+				t.Fatal("validateEnvVariables() error = nil, want the problems")
+			}
+			if !strings.Contains(err.Error(), "AVATAR_SIZE='8'") {
+				t.Errorf("validateEnvVariables() error = %q, want the problem of AVATAR_SIZE", err.Error())
+			}
+			if got := strings.Contains(err.Error(), "OUTPUT_IMAGE_UPDATE_INTERVAL"); got != (tt.wantProblem != "") ||
+				(tt.wantProblem != "" && !strings.Contains(err.Error(), tt.wantProblem)) {
+				t.Errorf("validateEnvVariables() error = %q, want the problem %q", err.Error(), tt.wantProblem)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// webhookMaxPayload is the max size of the payload of the GitHub webhook (the
+// GitHub caps the payloads at 25 MB).
+const webhookMaxPayload = 25 << 20
+
+// webhookQuietPeriod is the time after the last signed webhook of the source
+// of the repository, while the source is not polled by the refresh interval
+// (the webhooks refresh its images instead).
+const webhookQuietPeriod = 24 * time.Hour
+
+// webhookSources is a map of the sources of the images ("stargazers" or
+// "contributors"), which are affected by the events of the GitHub webhook. The
+// "fork" event is accepted, but no image depends on the forks.
+var webhookSources = map[string]string{
+	"star":   "stargazers",
+	"watch":  "stargazers",
+	"push":   "contributors",
+	"member": "contributors",
+	"fork":   "",
+}
+
+// webhookPayload is a struct that represents the fields of the payload of the
+// GitHub webhook, which are used to select the affected repository.
+type webhookPayload struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		FullName      string `json:"full_name"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+// webhookDebouncer schedules the refreshes by the keys, so a burst of the
+// events for the same key (e.g., many pushes in a row) causes one refresh.
+// The scheduled refreshes run with the current configuration of the
+// application (it may be reloaded, while the refresh waits).
+type webhookDebouncer struct {
+	mu      sync.Mutex
+	timers  map[string]*time.Timer
+	current *atomic.Pointer[Config]
+}
+
+// newWebhookDebouncer creates a new empty webhookDebouncer with the given
+// current configuration of the application.
+func newWebhookDebouncer(current *atomic.Pointer[Config]) *webhookDebouncer {
+	return &webhookDebouncer{timers: make(map[string]*time.Timer), current: current}
+}
+
+// schedule runs the given function after the given delay. If the function
+// with the same key is already scheduled, its delay is started again.
+func (d *webhookDebouncer) schedule(key string, delay time.Duration, fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Postpone the scheduled function, if it exists.
+	if timer, ok := d.timers[key]; ok {
+		timer.Reset(delay)
+		return
+	}
+
+	// Schedule the function, and forget it before it runs.
+	d.timers[key] = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		delete(d.timers, key)
+		d.mu.Unlock()
+
+		fn()
+	})
+}
+
+// handleWebhook returns an HTTP handler, which receives the events of the
+// GitHub webhook, verifies their signature by the GITHUB_WEBHOOK_SECRET, and
+// schedules the debounced refresh of the images of the affected repository,
+// which depend on the source affected by the event (see webhookSources).
+func (c *Config) handleWebhook(reg *Registry, debouncer *webhookDebouncer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Check, if the webhook endpoint is enabled.
+		if c.GithubWebhookSecret == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Read the payload of the event.
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxPayload))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// Verify the signature of the payload.
+		if !c.webhookVerify(payload, r.Header.Get("X-Hub-Signature-256")) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		// Answer the ping event, which is sent after the webhook is created.
+		event := r.Header.Get("X-GitHub-Event")
+		if event == "ping" {
+			fmt.Fprintln(w, "pong")
+			return
+		}
+
+		// Skip the unsupported events (e.g., the other events selected in the settings of the webhook).
+		source, ok := webhookSources[event]
+		if !ok {
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, "ignored unsupported '%s' event\n", event)
+			return
+		}
+
+		// Decode the payload of the event.
+		data := webhookPayload{}
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(payload, &data); err != nil {
+			http.Error(w, fmt.Sprintf("failed to decode payload (%s)", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		// Skip the events, which do not affect any image: the forks, and the pushes to other branches.
+		if source == "" || (event == "push" && data.Ref != "refs/heads/"+data.Repository.DefaultBranch) {
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, "ignored '%s' event, it does not affect any image\n", event)
+			return
+		}
+
+		// Skip the events of the repositories, which are not served.
+		owner, name, _ := strings.Cut(data.Repository.FullName, "/")
+		stats, ok := reg.lookup(owner, name)
+		if !ok {
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, "ignored '%s' event, repository '%s' is not served\n", event, data.Repository.FullName)
+			return
+		}
+
+		// Remember the webhook of the source, so the source is not polled while its webhooks arrive.
+		stats.setLastWebhook(source, time.Now())
+
+		// Schedule the refresh of the images of the repository, which depend on the affected source. The repository
+		// is looked up again, when the refresh runs, so the evicted or reloaded one is never refreshed.
+		debouncer.schedule(
+			registryKey(owner, name)+"/"+source, time.Duration(c.GithubWebhookDebounce)*time.Second,
+			func() {
+				if stats, ok := reg.lookup(owner, name); ok {
+					debouncer.current.Load().webhookRefresh(stats, source)
+				}
+			},
+		)
+
+		slog.Info("scheduled refresh by webhook", "repository", stats.repository().String(), "event", event, "source", source)
+
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "scheduled refresh of %s of '%s'\n", source, stats.repository().String())
+	}
+}
+
+// webhookVerify checks, if the given signature (e.g., "sha256=<hex>" from the
+// X-Hub-Signature-256 header) is the HMAC-SHA256 of the given payload with the
+// GITHUB_WEBHOOK_SECRET.
+func (c *Config) webhookVerify(payload []byte, signature string) bool {
+	// Decode the hex digest of the signature.
+	digest, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+
+	// Compute the HMAC-SHA256 of the payload, and compare it in the constant time.
+	mac := hmac.New(sha256.New, []byte(c.GithubWebhookSecret))
+	mac.Write(payload)
+
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// webhookRefresh fetches the users of the given source only, and prepares the
+// final images of the repository of the given stats.
+func (c *Config) webhookRefresh(stats *Stats, source string) {
+	// Select the images of the repository, which depend on the source.
+	images := make([]*imageDefinition, 0)
+	for _, def := range stats.repository().Images {
+		if def.Source == source {
+			images = append(images, def)
+		}
+	}
+	if len(images) == 0 {
+		return
+	}
+
+	// Fetch the avatar images and prepare the final images.
+	if err := c.updateStatsImages(stats, images); err != nil {
+		slog.Error("failed to refresh by webhook", "repository", stats.repository().String(), "details", err.Error())
+		return
+	}
+
+	slog.Info("successfully refreshed by webhook", "repository", stats.repository().String(), "source", source)
+}
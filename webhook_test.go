@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestWebhookVerify(t *testing.T) {
+	c := &Config{GithubWebhookSecret: "secret"}
+	payload := []byte(`{"action":"created"}`)
+
+	// Sign the payload with the same secret as GitHub does.
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(payload)
+	good := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		signature string
+		want      bool
+	}{
+		{"good signature", "sha256=" + good, true},
+		{"bad signature", "sha256=" + hex.EncodeToString(make([]byte, sha256.Size)), false},
+		{"missing prefix", good, false},
+		{"wrong prefix", "sha1=" + good, false},
+		{"bad hex", "sha256=not-a-hex-digest", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.webhookVerify(payload, tt.signature); got != tt.want {
+				t.Errorf("webhookVerify(%q) = %v, want %v", tt.signature, got, tt.want)
+			}
+		})
+	}
+}